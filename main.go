@@ -1,11 +1,33 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/hashicorp/terraform/plugin"
 	"github.com/shonenada/terraform-provider-qingcloud/qingcloud"
+	"github.com/shonenada/terraform-provider-qingcloud/template"
 )
 
 func main() {
+	// Terraform starts plugins without arguments. Any argument selects one
+	// of the commands rendering templates offline.
+	if len(os.Args) > 1 {
+		os.Exit(template.RunCommand(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	plugin.Serve(&plugin.ServeOpts{
-		ProviderFunc: template.Provider})
+		ProviderFunc: providerFunc(filepath.Base(os.Args[0]))})
+}
+
+// providerFunc returns the provider to serve. Terraform finds the plugin of
+// each provider by its binary name, so the binary serves the template
+// provider when installed as terraform-provider-template, and the QingCloud
+// provider otherwise.
+func providerFunc(name string) plugin.ProviderFunc {
+	if strings.HasPrefix(name, "terraform-provider-template") {
+		return template.Provider
+	}
+	return qingcloud.Provider
 }
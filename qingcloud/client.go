@@ -0,0 +1,164 @@
+package qingcloud
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signatureMethod  = "HmacSHA256"
+	signatureVersion = "1"
+	apiVersion       = "1"
+	timeStampFormat  = "2006-01-02T15:04:05Z"
+)
+
+// Return codes of the QingCloud API.
+const (
+	retCodeOK               = 0
+	retCodeResourceNotFound = 2100
+)
+
+// Client calls the QingCloud IaaS API, signing each request with the access
+// key of its Config.
+type Client struct {
+	accessKey  string
+	secretKey  string
+	zone       string
+	endpoint   *url.URL
+	httpClient *http.Client
+
+	// now returns the time requests are signed at.
+	now func() time.Time
+}
+
+// APIError is an error returned by the API, with a non-zero ret_code.
+type APIError struct {
+	Action  string
+	RetCode int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s failed with ret_code %d: %s", e.Action, e.RetCode, e.Message)
+}
+
+// isNotFound reports whether err is an API error for a missing resource.
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.RetCode == retCodeResourceNotFound
+}
+
+// Zone returns the zone requests are sent to.
+func (c *Client) Zone() string {
+	return c.zone
+}
+
+// Do calls action with params, and decodes the JSON response into out if it
+// isn't nil. The zone and the signature parameters are added to params. A
+// response with a non-zero ret_code is returned as an *APIError.
+func (c *Client) Do(action string, params url.Values, out interface{}) error {
+	query := url.Values{}
+	for k, v := range params {
+		query[k] = v
+	}
+	query.Set("action", action)
+	if query.Get("zone") == "" {
+		query.Set("zone", c.zone)
+	}
+	query.Set("access_key_id", c.accessKey)
+	query.Set("time_stamp", c.now().UTC().Format(timeStampFormat))
+	query.Set("version", apiVersion)
+	query.Set("signature_method", signatureMethod)
+	query.Set("signature_version", signatureVersion)
+
+	u := *c.endpoint
+	u.RawQuery = signQuery(c.secretKey, "GET", u.Path, query)
+
+	log.Printf("[DEBUG] QingCloud API request: %s", action)
+	resp, err := c.httpClient.Get(u.String())
+	if err != nil {
+		return fmt.Errorf("%s: %s", action, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s: %s", action, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected HTTP status %s", action, resp.Status)
+	}
+
+	var status struct {
+		RetCode int    `json:"ret_code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return fmt.Errorf("%s: could not decode response: %s", action, err)
+	}
+	if status.RetCode != retCodeOK {
+		return &APIError{Action: action, RetCode: status.RetCode, Message: status.Message}
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(body, out); err != nil {
+			return fmt.Errorf("%s: could not decode response: %s", action, err)
+		}
+	}
+	return nil
+}
+
+// signQuery returns the canonical query string of params followed by its
+// HmacSHA256 signature, as the QingCloud API expects for a request to path.
+func signQuery(secretKey, method, path string, params url.Values) string {
+	canonical := canonicalQuery(params)
+	return canonical + "&signature=" + url.QueryEscape(signature(secretKey, method, path, canonical))
+}
+
+// signature signs the canonical query string of a request.
+func signature(secretKey, method, path, canonical string) string {
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte(method + "\n" + path + "\n" + canonical))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalQuery encodes params sorted by name, with spaces encoded as %20
+// rather than +.
+func canonicalQuery(params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range params[k] {
+			pairs = append(pairs, escapeQuery(k)+"="+escapeQuery(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func escapeQuery(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// setList sets the elements of list as the parameters name.1, name.2 and so
+// on, as the API expects arrays.
+func setList(params url.Values, name string, list []string) {
+	for i, v := range list {
+		params.Set(name+"."+strconv.Itoa(i+1), v)
+	}
+}
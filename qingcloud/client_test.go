@@ -0,0 +1,167 @@
+package qingcloud
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignQuery(t *testing.T) {
+	// The example of the API signature documentation.
+	params := url.Values{}
+	for k, v := range map[string]string{
+		"count":             "1",
+		"vxnets.1":          "vxnet-0",
+		"zone":              "pek1",
+		"instance_type":     "small_b",
+		"signature_version": "1",
+		"signature_method":  "HmacSHA256",
+		"instance_name":     "demo",
+		"image_id":          "centos64x86a",
+		"login_mode":        "passwd",
+		"login_passwd":      "QingCloud20130712",
+		"version":           "1",
+		"access_key_id":     "QYACCESSKEYIDEXAMPLE",
+		"action":            "RunInstances",
+		"time_stamp":        "2013-08-27T14:30:10Z",
+	} {
+		params.Set(k, v)
+	}
+
+	expected := "access_key_id=QYACCESSKEYIDEXAMPLE&action=RunInstances&count=1" +
+		"&image_id=centos64x86a&instance_name=demo&instance_type=small_b" +
+		"&login_mode=passwd&login_passwd=QingCloud20130712&signature_method=HmacSHA256" +
+		"&signature_version=1&time_stamp=2013-08-27T14%3A30%3A10Z&version=1" +
+		"&vxnets.1=vxnet-0&zone=pek1" +
+		"&signature=32bseYy39DOlatuewpeuW5vpmW51sD1A%2FJdGynqSpP8%3D"
+	if got := signQuery("SECRETACCESSKEY", "GET", "/iaas/", params); got != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	params := url.Values{
+		"b":      {"a b"},
+		"a":      {"x~y/z"},
+		"name.1": {"中"},
+	}
+	expected := "a=x~y%2Fz&b=a%20b&name.1=%E4%B8%AD"
+	if got := canonicalQuery(params); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestClientDo(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+
+	var got url.Values
+	api.handle("DescribeInstances", func(params url.Values) (map[string]interface{}, error) {
+		got = params
+		return map[string]interface{}{
+			"total_count": 1,
+			"instance_set": []map[string]interface{}{
+				{"instance_id": "i-abc", "instance_name": "web 1"},
+			},
+		}, nil
+	})
+
+	client := api.client()
+	client.now = func() time.Time { return time.Date(2017, 9, 1, 8, 0, 0, 0, time.FixedZone("CST", 8*3600)) }
+
+	params := url.Values{"verbose": {"1"}}
+	setList(params, "instances", []string{"i-abc", "i-def"})
+	var resp struct {
+		TotalCount  int `json:"total_count"`
+		InstanceSet []struct {
+			InstanceID   string `json:"instance_id"`
+			InstanceName string `json:"instance_name"`
+		} `json:"instance_set"`
+	}
+	if err := client.Do("DescribeInstances", params, &resp); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if resp.TotalCount != 1 || len(resp.InstanceSet) != 1 || resp.InstanceSet[0].InstanceName != "web 1" {
+		t.Fatalf("unexpected response: %#v", resp)
+	}
+	if instances := fakeList(got, "instances"); !reflect.DeepEqual(instances, []string{"i-abc", "i-def"}) {
+		t.Fatalf("unexpected instances: %v", instances)
+	}
+	if ts := got.Get("time_stamp"); ts != "2017-09-01T00:00:00Z" {
+		t.Fatalf("expected a UTC time_stamp, got %q", ts)
+	}
+	if len(params) != 3 {
+		t.Fatalf("params were modified: %v", params)
+	}
+}
+
+func TestClientDoErrors(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	api.handle("DescribeJobs", func(params url.Values) (map[string]interface{}, error) {
+		return nil, &fakeError{2100, "ResourceNotFound, resource [j-abc] not found"}
+	})
+
+	err := api.client().Do("DescribeJobs", nil, nil)
+	if !isNotFound(err) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+	if expected := "DescribeJobs failed with ret_code 2100: ResourceNotFound"; !strings.HasPrefix(err.Error(), expected) {
+		t.Fatalf("expected %q, got %q", expected, err)
+	}
+
+	client := api.client()
+	client.secretKey = "wrong"
+	err = client.Do("DescribeJobs", nil, nil)
+	if apiErr, ok := err.(*APIError); !ok || apiErr.RetCode != 1200 || isNotFound(err) {
+		t.Fatalf("expected a signature error, got %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client, err = (&Config{Endpoint: server.URL + "/iaas/"}).Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Do("DescribeJobs", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "DescribeJobs: unexpected HTTP status 503") {
+		t.Fatalf("expected an HTTP error, got %v", err)
+	}
+}
+
+func TestConfigClient(t *testing.T) {
+	cases := map[string]struct {
+		Endpoint  string
+		Path      string
+		ExpectErr string
+	}{
+		"default":      {Endpoint: "", Path: "/iaas/"},
+		"private":      {Endpoint: "http://api.qingcloud.example:7777/iaas/", Path: "/iaas/"},
+		"no path":      {Endpoint: "https://api.qingcloud.example", Path: "/"},
+		"not http":     {Endpoint: "ftp://api.qingcloud.example/iaas/", ExpectErr: "must be an http or https URL"},
+		"not absolute": {Endpoint: "api.qingcloud.example/iaas/", ExpectErr: "must be an http or https URL"},
+	}
+
+	for tn, tc := range cases {
+		client, err := (&Config{Endpoint: tc.Endpoint}).Client()
+		if tc.ExpectErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.ExpectErr) {
+				t.Fatalf("%s: expected error %q, got %v", tn, tc.ExpectErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tn, err)
+		}
+		if client.endpoint.Path != tc.Path {
+			t.Fatalf("%s: expected path %q, got %q", tn, tc.Path, client.endpoint.Path)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package qingcloud
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+// DefaultEndpoint is the public QingCloud IaaS API.
+const DefaultEndpoint = "https://api.qingcloud.com/iaas/"
+
+// Config holds the settings of the provider block.
+type Config struct {
+	AccessKey string
+	SecretKey string
+	Zone      string
+	Endpoint  string
+}
+
+// Client returns a client for the API. It doesn't call the API, so that
+// credentials are only checked by the first request.
+func (c *Config) Client() (*Client, error) {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("endpoint: %s", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("endpoint: must be an http or https URL, got %q", endpoint)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	return &Client{
+		accessKey:  c.AccessKey,
+		secretKey:  c.SecretKey,
+		zone:       c.Zone,
+		endpoint:   u,
+		httpClient: cleanhttp.DefaultClient(),
+		now:        time.Now,
+	}, nil
+}
@@ -0,0 +1,218 @@
+package qingcloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "QYACCESSKEYIDEXAMPLE"
+	testSecretKey = "SECRETACCESSKEY"
+	testZone      = "pek3a"
+)
+
+// fakeAction handles a call to an action of the fake API, returning the
+// fields of the response or a *fakeError.
+type fakeAction func(params url.Values) (map[string]interface{}, error)
+
+type fakeError struct {
+	RetCode int
+	Message string
+}
+
+func (e *fakeError) Error() string { return e.Message }
+
+// fakeAPI is an in-process stand-in for the QingCloud API. It checks the
+// signature of every request like the real API, and dispatches it to the
+// handler of its action.
+type fakeAPI struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu       sync.Mutex
+	handlers map[string]fakeAction
+	calls    map[string][]url.Values
+	jobs     map[string]*fakeJob
+	nextID   int
+}
+
+// fakeJob is a job of an asynchronous action. Each DescribeJobs call moves it
+// to its next status, until the last one.
+type fakeJob struct {
+	Action   string
+	Statuses []string
+}
+
+func newFakeAPI(t *testing.T) *fakeAPI {
+	api := &fakeAPI{
+		t:        t,
+		handlers: map[string]fakeAction{},
+		calls:    map[string][]url.Values{},
+		jobs:     map[string]*fakeJob{},
+	}
+	api.server = httptest.NewServer(api)
+	api.handle("DescribeJobs", api.describeJobs)
+	return api
+}
+
+// newID returns a new resource ID with prefix, such as i-1.
+func (api *fakeAPI) newID(prefix string) string {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.nextID++
+	return fmt.Sprintf("%s-%d", prefix, api.nextID)
+}
+
+// startJob starts a job for action that succeeds after being pending and
+// working, and returns its ID.
+func (api *fakeAPI) startJob(action string) string {
+	return api.startJobWithStatuses(action, jobStatusPending, jobStatusWorking, jobStatusSuccessful)
+}
+
+func (api *fakeAPI) startJobWithStatuses(action string, statuses ...string) string {
+	id := api.newID("j")
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.jobs[id] = &fakeJob{Action: action, Statuses: statuses}
+	return id
+}
+
+func (api *fakeAPI) describeJobs(params url.Values) (map[string]interface{}, error) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	jobSet := []map[string]interface{}{}
+	for _, id := range fakeList(params, "jobs") {
+		job := api.jobs[id]
+		if job == nil {
+			continue
+		}
+		jobSet = append(jobSet, map[string]interface{}{
+			"job_id":     id,
+			"job_action": job.Action,
+			"status":     job.Statuses[0],
+		})
+		if len(job.Statuses) > 1 {
+			job.Statuses = job.Statuses[1:]
+		}
+	}
+	return map[string]interface{}{"job_set": jobSet, "total_count": len(jobSet)}, nil
+}
+
+func (api *fakeAPI) URL() string { return api.server.URL + "/iaas/" }
+
+func (api *fakeAPI) Close() { api.server.Close() }
+
+func (api *fakeAPI) handle(action string, h fakeAction) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.handlers[action] = h
+}
+
+// requests returns the parameters of the calls to action so far, in order.
+func (api *fakeAPI) requests(action string) []url.Values {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return append([]url.Values(nil), api.calls[action]...)
+}
+
+func (api *fakeAPI) client() *Client {
+	client, err := (&Config{
+		AccessKey: testAccessKey,
+		SecretKey: testSecretKey,
+		Zone:      testZone,
+		Endpoint:  api.URL(),
+	}).Client()
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	return client
+}
+
+// providerConfig returns a provider block for the fake API.
+func (api *fakeAPI) providerConfig() string {
+	return fmt.Sprintf(`
+provider "qingcloud" {
+	access_key = %q
+	secret_key = %q
+	zone       = %q
+	endpoint   = %q
+}
+`, testAccessKey, testSecretKey, testZone, api.URL())
+}
+
+func (api *fakeAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	params := req.URL.Query()
+	action := params.Get("action")
+	response, err := api.serve(req, params)
+
+	if response == nil {
+		response = map[string]interface{}{}
+	}
+	response["action"] = action + "Response"
+	response["ret_code"] = 0
+	if err != nil {
+		response["ret_code"] = 5000
+		if fe, ok := err.(*fakeError); ok {
+			response["ret_code"] = fe.RetCode
+		}
+		response["message"] = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (api *fakeAPI) serve(req *http.Request, params url.Values) (map[string]interface{}, error) {
+	if req.Method != "GET" || req.URL.Path != "/iaas/" {
+		return nil, &fakeError{1100, fmt.Sprintf("unexpected request %s %s", req.Method, req.URL.Path)}
+	}
+
+	sig := params.Get("signature")
+	params.Del("signature")
+	if params.Get("access_key_id") != testAccessKey {
+		return nil, &fakeError{1200, "unknown access key"}
+	}
+	if sig != signature(testSecretKey, "GET", "/iaas/", canonicalQuery(params)) {
+		return nil, &fakeError{1200, "signature mismatch"}
+	}
+	for k, want := range map[string]string{
+		"version":           "1",
+		"signature_method":  "HmacSHA256",
+		"signature_version": "1",
+		"zone":              testZone,
+	} {
+		if got := params.Get(k); got != want {
+			return nil, &fakeError{1100, fmt.Sprintf("%s: expected %q, got %q", k, want, got)}
+		}
+	}
+	if _, err := time.Parse(timeStampFormat, params.Get("time_stamp")); err != nil {
+		return nil, &fakeError{1100, "time_stamp: " + err.Error()}
+	}
+
+	action := params.Get("action")
+	api.mu.Lock()
+	api.calls[action] = append(api.calls[action], params)
+	h := api.handlers[action]
+	api.mu.Unlock()
+	if h == nil {
+		return nil, &fakeError{1100, "unsupported action " + action}
+	}
+	return h(params)
+}
+
+// fakeList returns the elements of the array parameter name.
+func fakeList(params url.Values, name string) []string {
+	var list []string
+	for i := 1; ; i++ {
+		v, ok := params[fmt.Sprintf("%s.%d", name, i)]
+		if !ok {
+			return list
+		}
+		list = append(list, v[0])
+	}
+}
@@ -0,0 +1,187 @@
+package qingcloud
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// fakeEIPs implements the EIP actions of the fake API.
+type fakeEIPs struct {
+	api *fakeAPI
+
+	mu   sync.Mutex
+	eips map[string]map[string]interface{}
+}
+
+// newFakeEIPs registers the EIP actions of the fake API. Binding EIPs to
+// routers with ModifyRouterAttributes is supported if network isn't nil.
+func newFakeEIPs(api *fakeAPI, network *fakeNetwork) *fakeEIPs {
+	f := &fakeEIPs{
+		api:  api,
+		eips: map[string]map[string]interface{}{},
+	}
+	api.handle("AllocateEips", f.allocate)
+	api.handle("DescribeEips", f.describe)
+	api.handle("ModifyEipAttributes", f.modify)
+	api.handle("ChangeEipsBandwidth", f.changeBandwidth)
+	api.handle("ReleaseEips", f.release)
+	api.handle("AssociateEip", f.associate)
+	api.handle("DissociateEips", f.dissociate)
+	if network != nil {
+		api.handle("ModifyRouterAttributes", func(params url.Values) (map[string]interface{}, error) {
+			if _, ok := params["eip"]; ok {
+				if err := f.bindRouter(params.Get("router"), params.Get("eip")); err != nil {
+					return nil, err
+				}
+			}
+			return network.modifyRouter(params)
+		})
+	}
+	return f
+}
+
+func (f *fakeEIPs) allocate(params url.Values) (map[string]interface{}, error) {
+	id := f.api.newID("eip")
+	bandwidth, _ := strconv.Atoi(params.Get("bandwidth"))
+	needICP, _ := strconv.Atoi(params.Get("need_icp"))
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.eips[id] = map[string]interface{}{
+		"eip_id":       id,
+		"eip_name":     params.Get("eip_name"),
+		"description":  "",
+		"eip_addr":     fmt.Sprintf("139.198.1.%d", len(f.eips)+1),
+		"bandwidth":    bandwidth,
+		"billing_mode": params.Get("billing_mode"),
+		"need_icp":     needICP,
+		"status":       "available",
+		"resource":     map[string]interface{}{},
+	}
+	return map[string]interface{}{"eips": []string{id}}, nil
+}
+
+func (f *fakeEIPs) describe(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	set := []map[string]interface{}{}
+	for _, id := range fakeList(params, "eips") {
+		if eip, ok := f.eips[id]; ok {
+			set = append(set, eip)
+		}
+	}
+	return map[string]interface{}{"eip_set": set, "total_count": len(set)}, nil
+}
+
+func (f *fakeEIPs) modify(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	eip, ok := f.eips[params.Get("eip")]
+	if !ok {
+		return nil, &fakeError{2100, "ResourceNotFound"}
+	}
+	eip["eip_name"] = params.Get("eip_name")
+	eip["description"] = params.Get("description")
+	return nil, nil
+}
+
+func (f *fakeEIPs) changeBandwidth(params url.Values) (map[string]interface{}, error) {
+	bandwidth, _ := strconv.Atoi(params.Get("bandwidth"))
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range fakeList(params, "eips") {
+		eip, ok := f.eips[id]
+		if !ok {
+			return nil, &fakeError{2100, "ResourceNotFound"}
+		}
+		eip["bandwidth"] = bandwidth
+	}
+	return map[string]interface{}{"job_id": f.api.startJob("ChangeEipsBandwidth")}, nil
+}
+
+func (f *fakeEIPs) release(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range fakeList(params, "eips") {
+		eip, ok := f.eips[id]
+		if !ok || eip["status"] == eipStatusReleased {
+			return nil, &fakeError{2100, "ResourceNotFound"}
+		}
+		if eip["status"] == "associated" {
+			return nil, &fakeError{2400, fmt.Sprintf("eip %s is still associated", id)}
+		}
+		eip["status"] = eipStatusReleased
+	}
+	return map[string]interface{}{"job_id": f.api.startJob("ReleaseEips")}, nil
+}
+
+func (f *fakeEIPs) associate(params url.Values) (map[string]interface{}, error) {
+	if err := f.setResource(params.Get("eip"), params.Get("instance"), eipResourceInstance); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"job_id": f.api.startJob("AssociateEip")}, nil
+}
+
+func (f *fakeEIPs) dissociate(params url.Values) (map[string]interface{}, error) {
+	for _, id := range fakeList(params, "eips") {
+		if err := f.setResource(id, "", ""); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]interface{}{"job_id": f.api.startJob("DissociateEips")}, nil
+}
+
+// bindRouter associates eipID with a router, or dissociates the EIP of the
+// router if eipID is empty.
+func (f *fakeEIPs) bindRouter(routerID, eipID string) error {
+	f.mu.Lock()
+	var current string
+	for id, eip := range f.eips {
+		if eip["resource"].(map[string]interface{})["resource_id"] == routerID {
+			current = id
+		}
+	}
+	f.mu.Unlock()
+
+	if current != "" {
+		if err := f.setResource(current, "", ""); err != nil {
+			return err
+		}
+	}
+	if eipID == "" {
+		return nil
+	}
+	return f.setResource(eipID, routerID, eipResourceRouter)
+}
+
+// setResource associates an EIP with a resource, or dissociates it if
+// resourceID is empty.
+func (f *fakeEIPs) setResource(eipID, resourceID, resourceType string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	eip, ok := f.eips[eipID]
+	if !ok || eip["status"] == eipStatusReleased {
+		return &fakeError{2100, "ResourceNotFound"}
+	}
+	associated := eip["status"] == "associated"
+	switch {
+	case resourceID == "" && !associated:
+		return &fakeError{2400, fmt.Sprintf("eip %s is not associated", eipID)}
+	case resourceID != "" && associated:
+		return &fakeError{2400, fmt.Sprintf("eip %s is already associated", eipID)}
+	case resourceID == "":
+		eip["status"] = "available"
+		eip["resource"] = map[string]interface{}{}
+	default:
+		eip["status"] = "associated"
+		eip["resource"] = map[string]interface{}{"resource_id": resourceID, "resource_type": resourceType}
+	}
+	return nil
+}
+
+func (f *fakeEIPs) set(id, key string, value interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.eips[id][key] = value
+}
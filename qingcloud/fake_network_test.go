@@ -0,0 +1,351 @@
+package qingcloud
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// fakeNetwork implements the vxnet and router actions of the fake API.
+type fakeNetwork struct {
+	api *fakeAPI
+
+	mu      sync.Mutex
+	vxnets  map[string]map[string]interface{}
+	routers map[string]map[string]interface{}
+	// joined maps the ID of each vxnet joined to a router to its network.
+	joined  map[string]string
+	statics map[string][]map[string]interface{}
+}
+
+func newFakeNetwork(api *fakeAPI) *fakeNetwork {
+	f := &fakeNetwork{
+		api:     api,
+		vxnets:  map[string]map[string]interface{}{},
+		routers: map[string]map[string]interface{}{},
+		joined:  map[string]string{},
+		statics: map[string][]map[string]interface{}{},
+	}
+	api.handle("CreateVxnets", f.createVxnets)
+	api.handle("DescribeVxnets", f.describeVxnets)
+	api.handle("ModifyVxnetAttributes", f.modifyVxnet)
+	api.handle("DeleteVxnets", f.deleteVxnets)
+	api.handle("JoinRouter", f.joinRouter)
+	api.handle("LeaveRouter", f.leaveRouter)
+	api.handle("CreateRouters", f.createRouters)
+	api.handle("DescribeRouters", f.describeRouters)
+	api.handle("ModifyRouterAttributes", f.modifyRouter)
+	api.handle("UpdateRouters", f.updateRouters)
+	api.handle("DeleteRouters", f.deleteRouters)
+	api.handle("DescribeRouterVxnets", f.describeRouterVxnets)
+	api.handle("DescribeRouterStatics", f.describeRouterStatics)
+	api.handle("AddRouterStatics", f.addRouterStatics)
+	api.handle("DeleteRouterStatics", f.deleteRouterStatics)
+	return f
+}
+
+func (f *fakeNetwork) createVxnets(params url.Values) (map[string]interface{}, error) {
+	id := f.api.newID("vxnet")
+	vxnetType, _ := strconv.Atoi(params.Get("vxnet_type"))
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.vxnets[id] = map[string]interface{}{
+		"vxnet_id":    id,
+		"vxnet_name":  params.Get("vxnet_name"),
+		"vxnet_type":  vxnetType,
+		"description": "",
+		"router":      map[string]interface{}{},
+	}
+	return map[string]interface{}{"vxnets": []string{id}}, nil
+}
+
+func (f *fakeNetwork) describeVxnets(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	set := []map[string]interface{}{}
+	for _, id := range fakeList(params, "vxnets") {
+		if vxnet, ok := f.vxnets[id]; ok {
+			set = append(set, vxnet)
+		}
+	}
+	return map[string]interface{}{"vxnet_set": set, "total_count": len(set)}, nil
+}
+
+func (f *fakeNetwork) modifyVxnet(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	vxnet, ok := f.vxnets[params.Get("vxnet")]
+	if !ok {
+		return nil, &fakeError{2100, "ResourceNotFound"}
+	}
+	vxnet["vxnet_name"] = params.Get("vxnet_name")
+	vxnet["description"] = params.Get("description")
+	return nil, nil
+}
+
+func (f *fakeNetwork) deleteVxnets(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range fakeList(params, "vxnets") {
+		if _, ok := f.vxnets[id]; !ok {
+			return nil, &fakeError{2100, "ResourceNotFound"}
+		}
+		if _, ok := f.joined[id]; ok {
+			return nil, &fakeError{2400, fmt.Sprintf("vxnet %s is still joined to a router", id)}
+		}
+		delete(f.vxnets, id)
+	}
+	return nil, nil
+}
+
+func (f *fakeNetwork) joinRouter(params url.Values) (map[string]interface{}, error) {
+	vxnetID, routerID := params.Get("vxnet"), params.Get("router")
+	if err := f.join(vxnetID, routerID, params.Get("ip_network")); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"job_id": f.api.startJob("JoinRouter")}, nil
+}
+
+// join joins a vxnet to a router, like JoinRouter.
+func (f *fakeNetwork) join(vxnetID, routerID, ipNetwork string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	vxnet, ok := f.vxnets[vxnetID]
+	if !ok || f.routers[routerID] == nil {
+		return &fakeError{2100, "ResourceNotFound"}
+	}
+	if _, ok := f.joined[vxnetID]; ok {
+		return &fakeError{2400, fmt.Sprintf("vxnet %s is already joined to a router", vxnetID)}
+	}
+	vxnet["router"] = map[string]interface{}{"router_id": routerID}
+	f.joined[vxnetID] = ipNetwork
+	return nil
+}
+
+func (f *fakeNetwork) leaveRouter(params url.Values) (map[string]interface{}, error) {
+	for _, id := range fakeList(params, "vxnets") {
+		if err := f.leave(id, params.Get("router")); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]interface{}{"job_id": f.api.startJob("LeaveRouter")}, nil
+}
+
+// leave makes a vxnet leave its router, like LeaveRouter.
+func (f *fakeNetwork) leave(vxnetID, routerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	vxnet, ok := f.vxnets[vxnetID]
+	if !ok {
+		return &fakeError{2100, "ResourceNotFound"}
+	}
+	if vxnet["router"].(map[string]interface{})["router_id"] != routerID {
+		return &fakeError{2400, fmt.Sprintf("vxnet %s is not joined to router %s", vxnetID, routerID)}
+	}
+	vxnet["router"] = map[string]interface{}{}
+	delete(f.joined, vxnetID)
+	return nil
+}
+
+func (f *fakeNetwork) createRouters(params url.Values) (map[string]interface{}, error) {
+	id := f.api.newID("rtr")
+	routerType, _ := strconv.Atoi(params.Get("router_type"))
+	vpcNetwork := params.Get("vpc_network")
+	if vpcNetwork == "" {
+		vpcNetwork = "192.168.0.0/16"
+	}
+	securityGroup := params.Get("security_group")
+	if securityGroup == "" {
+		securityGroup = "sg-default"
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.routers[id] = map[string]interface{}{
+		"router_id":         id,
+		"router_name":       params.Get("router_name"),
+		"description":       "",
+		"router_type":       routerType,
+		"vpc_network":       vpcNetwork,
+		"security_group_id": securityGroup,
+		"status":            "active",
+		"eip":               map[string]interface{}{},
+	}
+	return map[string]interface{}{
+		"routers": []string{id},
+		"job_id":  f.api.startJob("CreateRouters"),
+	}, nil
+}
+
+func (f *fakeNetwork) describeRouters(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	set := []map[string]interface{}{}
+	for _, id := range fakeList(params, "routers") {
+		if router, ok := f.routers[id]; ok {
+			set = append(set, router)
+		}
+	}
+	return map[string]interface{}{"router_set": set, "total_count": len(set)}, nil
+}
+
+func (f *fakeNetwork) modifyRouter(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	router, ok := f.routers[params.Get("router")]
+	if !ok {
+		return nil, &fakeError{2100, "ResourceNotFound"}
+	}
+	for _, k := range []string{"router_name", "description"} {
+		if _, ok := params[k]; ok {
+			router[k] = params.Get(k)
+		}
+	}
+	if sg := params.Get("security_group"); sg != "" {
+		router["security_group_id"] = sg
+	}
+	if _, ok := params["eip"]; ok {
+		eip := map[string]interface{}{}
+		if id := params.Get("eip"); id != "" {
+			eip = map[string]interface{}{"eip_id": id, "eip_addr": "139.198.0.1"}
+		}
+		router["eip"] = eip
+	}
+	return nil, nil
+}
+
+func (f *fakeNetwork) updateRouters(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range fakeList(params, "routers") {
+		if _, ok := f.routers[id]; !ok {
+			return nil, &fakeError{2100, "ResourceNotFound"}
+		}
+	}
+	return map[string]interface{}{"job_id": f.api.startJob("UpdateRouters")}, nil
+}
+
+func (f *fakeNetwork) deleteRouters(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range fakeList(params, "routers") {
+		router, ok := f.routers[id]
+		if !ok || router["status"] == routerStatusCeased {
+			return nil, &fakeError{2100, "ResourceNotFound"}
+		}
+		router["status"] = routerStatusDeleted
+	}
+	return map[string]interface{}{"job_id": f.api.startJob("DeleteRouters")}, nil
+}
+
+func (f *fakeNetwork) describeRouterVxnets(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	routerID := params.Get("router")
+	if _, ok := f.routers[routerID]; !ok {
+		return nil, &fakeError{2100, "ResourceNotFound"}
+	}
+	set := []map[string]interface{}{}
+	for _, id := range f.sortedVxnetIDs() {
+		vxnet := f.vxnets[id]
+		if vxnet["router"].(map[string]interface{})["router_id"] != routerID {
+			continue
+		}
+		if v := params.Get("vxnet"); v != "" && v != id {
+			continue
+		}
+		set = append(set, map[string]interface{}{
+			"router_id":  routerID,
+			"vxnet_id":   id,
+			"ip_network": f.joined[id],
+		})
+	}
+	return map[string]interface{}{"router_vxnet_set": set, "total_count": len(set)}, nil
+}
+
+func (f *fakeNetwork) describeRouterStatics(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	set := f.statics[params.Get("router")]
+	if set == nil {
+		set = []map[string]interface{}{}
+	}
+	return map[string]interface{}{"router_static_set": set, "total_count": len(set)}, nil
+}
+
+func (f *fakeNetwork) addRouterStatics(params url.Values) (map[string]interface{}, error) {
+	routerID := params.Get("router")
+	var ids []string
+	for i := 1; ; i++ {
+		prefix := fmt.Sprintf("statics.%d.", i)
+		if _, ok := params[prefix+"static_type"]; !ok {
+			break
+		}
+		staticType, _ := strconv.Atoi(params.Get(prefix + "static_type"))
+		id := f.api.newID("rtrs")
+		f.addStatic(routerID, map[string]interface{}{
+			"router_static_id":   id,
+			"router_static_name": params.Get(prefix + "router_static_name"),
+			"static_type":        staticType,
+			"val1":               params.Get(prefix + "val1"),
+			"val2":               params.Get(prefix + "val2"),
+			"val3":               params.Get(prefix + "val3"),
+			"val4":               params.Get(prefix + "val4"),
+		})
+		ids = append(ids, id)
+	}
+	return map[string]interface{}{"router_statics": ids}, nil
+}
+
+func (f *fakeNetwork) addStatic(routerID string, static map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statics[routerID] = append(f.statics[routerID], static)
+}
+
+func (f *fakeNetwork) deleteRouterStatics(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	remove := map[string]bool{}
+	for _, id := range fakeList(params, "router_statics") {
+		remove[id] = true
+	}
+	for routerID, statics := range f.statics {
+		kept := []map[string]interface{}{}
+		for _, s := range statics {
+			if !remove[s["router_static_id"].(string)] {
+				kept = append(kept, s)
+			}
+		}
+		f.statics[routerID] = kept
+	}
+	return nil, nil
+}
+
+func (f *fakeNetwork) sortedVxnetIDs() []string {
+	ids := make([]string, 0, len(f.vxnets))
+	for id := range f.vxnets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// newVxnet creates a vxnet outside of Terraform and returns its ID.
+func (f *fakeNetwork) newVxnet() string {
+	resp, _ := f.createVxnets(url.Values{"vxnet_type": {"1"}})
+	return resp["vxnets"].([]string)[0]
+}
+
+func (f *fakeNetwork) setRouter(id, key string, value interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.routers[id][key] = value
+}
+
+func (f *fakeNetwork) setVxnet(id, key string, value interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.vxnets[id][key] = value
+}
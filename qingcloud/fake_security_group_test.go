@@ -0,0 +1,209 @@
+package qingcloud
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// fakeSecurityGroups implements the security group actions of the fake API.
+// Rule changes only take effect once ApplySecurityGroup is called, like in
+// the real API.
+type fakeSecurityGroups struct {
+	api *fakeAPI
+
+	mu     sync.Mutex
+	groups map[string]map[string]interface{}
+	rules  map[string]map[string]interface{}
+	// applied holds the IDs of the rules of each group when it was last
+	// applied.
+	applied map[string][]string
+}
+
+func newFakeSecurityGroups(api *fakeAPI) *fakeSecurityGroups {
+	f := &fakeSecurityGroups{
+		api:     api,
+		groups:  map[string]map[string]interface{}{},
+		rules:   map[string]map[string]interface{}{},
+		applied: map[string][]string{},
+	}
+	api.handle("CreateSecurityGroup", f.create)
+	api.handle("DescribeSecurityGroups", f.describe)
+	api.handle("ModifySecurityGroupAttributes", f.modify)
+	api.handle("DeleteSecurityGroups", f.delete)
+	api.handle("DescribeSecurityGroupRules", f.describeRules)
+	api.handle("AddSecurityGroupRules", f.addRules)
+	api.handle("DeleteSecurityGroupRules", f.deleteRules)
+	api.handle("ApplySecurityGroup", f.apply)
+	return f
+}
+
+func (f *fakeSecurityGroups) create(params url.Values) (map[string]interface{}, error) {
+	id := f.api.newID("sg")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.groups[id] = map[string]interface{}{
+		"security_group_id":   id,
+		"security_group_name": params.Get("security_group_name"),
+		"description":         "",
+	}
+	return map[string]interface{}{"security_group_id": id}, nil
+}
+
+func (f *fakeSecurityGroups) describe(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	set := []map[string]interface{}{}
+	for _, id := range fakeList(params, "security_groups") {
+		if group, ok := f.groups[id]; ok {
+			set = append(set, group)
+		}
+	}
+	return map[string]interface{}{"security_group_set": set, "total_count": len(set)}, nil
+}
+
+func (f *fakeSecurityGroups) modify(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	group, ok := f.groups[params.Get("security_group")]
+	if !ok {
+		return nil, &fakeError{2100, "ResourceNotFound"}
+	}
+	group["security_group_name"] = params.Get("security_group_name")
+	group["description"] = params.Get("description")
+	return nil, nil
+}
+
+func (f *fakeSecurityGroups) delete(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range fakeList(params, "security_groups") {
+		if _, ok := f.groups[id]; !ok {
+			return nil, &fakeError{2100, "ResourceNotFound"}
+		}
+		delete(f.groups, id)
+		for ruleID, rule := range f.rules {
+			if rule["security_group_id"] == id {
+				delete(f.rules, ruleID)
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeSecurityGroups) describeRules(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	groupID := params.Get("security_group")
+	ids := fakeList(params, "security_group_rules")
+	if len(ids) == 0 {
+		ids = f.sortedRuleIDs()
+	}
+	set := []map[string]interface{}{}
+	for _, id := range ids {
+		rule, ok := f.rules[id]
+		if !ok || groupID != "" && rule["security_group_id"] != groupID {
+			continue
+		}
+		set = append(set, rule)
+	}
+	return map[string]interface{}{"security_group_rule_set": set, "total_count": len(set)}, nil
+}
+
+func (f *fakeSecurityGroups) addRules(params url.Values) (map[string]interface{}, error) {
+	groupID := params.Get("security_group")
+	f.mu.Lock()
+	_, ok := f.groups[groupID]
+	f.mu.Unlock()
+	if !ok {
+		return nil, &fakeError{2100, "ResourceNotFound"}
+	}
+
+	var ids []string
+	for i := 1; ; i++ {
+		prefix := fmt.Sprintf("rules.%d.", i)
+		if _, ok := params[prefix+"protocol"]; !ok {
+			break
+		}
+		priority, _ := strconv.Atoi(params.Get(prefix + "priority"))
+		direction, _ := strconv.Atoi(params.Get(prefix + "direction"))
+		id := f.api.newID("sgr")
+		f.addRule(map[string]interface{}{
+			"security_group_rule_id":   id,
+			"security_group_id":        groupID,
+			"security_group_rule_name": params.Get(prefix + "security_group_rule_name"),
+			"protocol":                 params.Get(prefix + "protocol"),
+			"priority":                 priority,
+			"action":                   params.Get(prefix + "action"),
+			"direction":                direction,
+			"val1":                     params.Get(prefix + "val1"),
+			"val2":                     params.Get(prefix + "val2"),
+			"val3":                     params.Get(prefix + "val3"),
+		})
+		ids = append(ids, id)
+	}
+	return map[string]interface{}{"security_group_rules": ids}, nil
+}
+
+// addRule adds a rule without applying its security group.
+func (f *fakeSecurityGroups) addRule(rule map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules[rule["security_group_rule_id"].(string)] = rule
+}
+
+func (f *fakeSecurityGroups) deleteRules(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range fakeList(params, "security_group_rules") {
+		if _, ok := f.rules[id]; !ok {
+			return nil, &fakeError{2100, "ResourceNotFound"}
+		}
+		delete(f.rules, id)
+	}
+	return nil, nil
+}
+
+func (f *fakeSecurityGroups) apply(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	groupID := params.Get("security_group")
+	if _, ok := f.groups[groupID]; !ok {
+		return nil, &fakeError{2100, "ResourceNotFound"}
+	}
+	f.applied[groupID] = f.groupRuleIDs(groupID)
+	return map[string]interface{}{"job_id": f.api.startJob("ApplySecurityGroup")}, nil
+}
+
+// checkApplied returns an error if the rules of a security group changed
+// since it was last applied.
+func (f *fakeSecurityGroups) checkApplied(groupID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	current, applied := f.groupRuleIDs(groupID), f.applied[groupID]
+	if fmt.Sprint(current) != fmt.Sprint(applied) {
+		return fmt.Errorf("security group %s has rules %v but %v were applied", groupID, current, applied)
+	}
+	return nil
+}
+
+func (f *fakeSecurityGroups) groupRuleIDs(groupID string) []string {
+	var ids []string
+	for _, id := range f.sortedRuleIDs() {
+		if f.rules[id]["security_group_id"] == groupID {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (f *fakeSecurityGroups) sortedRuleIDs() []string {
+	ids := make([]string, 0, len(f.rules))
+	for id := range f.rules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
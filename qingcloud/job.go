@@ -0,0 +1,78 @@
+package qingcloud
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+// Statuses of the jobs returned by DescribeJobs.
+const (
+	jobStatusPending         = "pending"
+	jobStatusWorking         = "working"
+	jobStatusSuccessful      = "successful"
+	jobStatusFailed          = "failed"
+	jobStatusDoneWithFailure = "done with failure"
+)
+
+// jobPollInterval is how often WaitJob polls DescribeJobs.
+var jobPollInterval = 3 * time.Second
+
+type describeJobsResponse struct {
+	JobSet []struct {
+		JobID  string `json:"job_id"`
+		Action string `json:"job_action"`
+		Status string `json:"status"`
+	} `json:"job_set"`
+}
+
+// WaitJob waits for the job started by an asynchronous action to succeed,
+// polling DescribeJobs. It fails if the job fails or is still pending or
+// working after timeout.
+func (c *Client) WaitJob(jobID string, timeout time.Duration) error {
+	conf := &resource.StateChangeConf{
+		Pending:      []string{jobStatusPending, jobStatusWorking},
+		Target:       []string{jobStatusSuccessful},
+		Refresh:      c.jobStatus(jobID),
+		Timeout:      timeout,
+		PollInterval: jobPollInterval,
+	}
+	if _, err := conf.WaitForState(); err != nil {
+		return fmt.Errorf("error waiting for job %s: %s", jobID, err)
+	}
+	return nil
+}
+
+// DoJob calls an asynchronous action and waits for its job to succeed.
+func (c *Client) DoJob(action string, params url.Values, timeout time.Duration) error {
+	var resp struct {
+		JobID string `json:"job_id"`
+	}
+	if err := c.Do(action, params, &resp); err != nil {
+		return err
+	}
+	return c.WaitJob(resp.JobID, timeout)
+}
+
+func (c *Client) jobStatus(jobID string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		params := url.Values{}
+		setList(params, "jobs", []string{jobID})
+		var resp describeJobsResponse
+		if err := c.Do("DescribeJobs", params, &resp); err != nil {
+			return nil, "", err
+		}
+		if len(resp.JobSet) == 0 {
+			return nil, "", fmt.Errorf("job not found")
+		}
+
+		job := resp.JobSet[0]
+		switch job.Status {
+		case jobStatusFailed, jobStatusDoneWithFailure:
+			return nil, "", fmt.Errorf("%s job %s", job.Action, job.Status)
+		}
+		return job, job.Status, nil
+	}
+}
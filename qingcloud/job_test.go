@@ -0,0 +1,75 @@
+package qingcloud
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	// Don't make tests wait for fake jobs.
+	jobPollInterval = time.Millisecond
+}
+
+func TestWaitJob(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	client := api.client()
+
+	cases := map[string]struct {
+		Statuses  []string
+		Timeout   time.Duration
+		ExpectErr string
+	}{
+		"successful": {
+			Statuses: []string{jobStatusPending, jobStatusWorking, jobStatusWorking, jobStatusSuccessful},
+		},
+		"failed": {
+			Statuses:  []string{jobStatusPending, jobStatusFailed},
+			ExpectErr: "RunInstances job failed",
+		},
+		"done with failure": {
+			Statuses:  []string{jobStatusWorking, jobStatusDoneWithFailure},
+			ExpectErr: "RunInstances job done with failure",
+		},
+		"timeout": {
+			Statuses:  []string{jobStatusPending},
+			Timeout:   50 * time.Millisecond,
+			ExpectErr: "timeout while waiting for state to become 'successful'",
+		},
+	}
+
+	for tn, tc := range cases {
+		id := api.startJobWithStatuses("RunInstances", tc.Statuses...)
+		timeout := tc.Timeout
+		if timeout == 0 {
+			timeout = time.Minute
+		}
+
+		err := client.WaitJob(id, timeout)
+		if tc.ExpectErr == "" {
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %s", tn, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.ExpectErr) {
+			t.Fatalf("%s: expected error %q, got %v", tn, tc.ExpectErr, err)
+		}
+		if !strings.HasPrefix(err.Error(), "error waiting for job "+id+": ") {
+			t.Fatalf("%s: expected the job ID in %q", tn, err)
+		}
+	}
+
+	if err := client.WaitJob("j-missing", time.Minute); err == nil || !strings.Contains(err.Error(), "job not found") {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+
+	api.handle("DescribeJobs", func(params url.Values) (map[string]interface{}, error) {
+		return nil, &fakeError{5100, "ServerBusy"}
+	})
+	if err := client.WaitJob("j-busy", time.Minute); err == nil || !strings.Contains(err.Error(), "ret_code 5100") {
+		t.Fatalf("expected an API error, got %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package qingcloud
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func Provider() terraform.ResourceProvider {
+	return &schema.Provider{
+		Schema: map[string]*schema.Schema{
+			"access_key": {
+				Type:        schema.TypeString,
+				Required:    true,
+				DefaultFunc: schema.EnvDefaultFunc("QINGCLOUD_ACCESS_KEY", nil),
+				Description: "access key ID of the API key pair",
+			},
+			"secret_key": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("QINGCLOUD_SECRET_KEY", nil),
+				Description: "secret access key of the API key pair",
+			},
+			"zone": {
+				Type:        schema.TypeString,
+				Required:    true,
+				DefaultFunc: schema.EnvDefaultFunc("QINGCLOUD_ZONE", nil),
+				Description: "zone resources are managed in, such as pek3a",
+			},
+			"endpoint": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("QINGCLOUD_ENDPOINT", DefaultEndpoint),
+				Description: "URL of the IaaS API",
+			},
+		},
+		DataSourcesMap: map[string]*schema.Resource{},
+		ResourcesMap: map[string]*schema.Resource{
+			"qingcloud_eip":                 resourceQingcloudEIP(),
+			"qingcloud_eip_association":     resourceQingcloudEIPAssociation(),
+			"qingcloud_instance":            resourceQingcloudInstance(),
+			"qingcloud_router":              resourceQingcloudRouter(),
+			"qingcloud_security_group":      resourceQingcloudSecurityGroup(),
+			"qingcloud_security_group_rule": resourceQingcloudSecurityGroupRule(),
+			"qingcloud_vxnet":               resourceQingcloudVxnet(),
+		},
+		ConfigureFunc: providerConfigure,
+	}
+}
+
+func providerConfigure(d *schema.ResourceData) (interface{}, error) {
+	config := &Config{
+		AccessKey: d.Get("access_key").(string),
+		SecretKey: d.Get("secret_key").(string),
+		Zone:      d.Get("zone").(string),
+		Endpoint:  d.Get("endpoint").(string),
+	}
+	return config.Client()
+}
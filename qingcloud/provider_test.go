@@ -0,0 +1,45 @@
+package qingcloud
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestProvider(t *testing.T) {
+	if err := Provider().(*schema.Provider).InternalValidate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestProviderConfigureEnv(t *testing.T) {
+	env := map[string]string{
+		"QINGCLOUD_ACCESS_KEY": "env-access",
+		"QINGCLOUD_SECRET_KEY": "env-secret",
+		"QINGCLOUD_ZONE":       "sh1a",
+		"QINGCLOUD_ENDPOINT":   "http://127.0.0.1:7777/iaas/",
+	}
+	for k, v := range env {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+
+	p := Provider().(*schema.Provider)
+	raw := map[string]interface{}{"zone": "pek3a"}
+	if err := p.Configure(&terraform.ResourceConfig{Raw: raw, Config: raw}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	client := p.Meta().(*Client)
+	if client.accessKey != "env-access" || client.secretKey != "env-secret" {
+		t.Fatalf("unexpected credentials: %q, %q", client.accessKey, client.secretKey)
+	}
+	if client.Zone() != "pek3a" {
+		t.Fatalf("expected the zone of the configuration, got %q", client.Zone())
+	}
+	if client.endpoint.String() != env["QINGCLOUD_ENDPOINT"] {
+		t.Fatalf("unexpected endpoint: %s", client.endpoint)
+	}
+}
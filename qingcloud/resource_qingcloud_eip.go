@@ -0,0 +1,225 @@
+package qingcloud
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// Statuses of the EIPs returned by DescribeEips.
+const (
+	eipStatusReleased = "released"
+	eipStatusCeased   = "ceased"
+)
+
+func resourceQingcloudEIP() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceQingcloudEIPCreate,
+		Read:   resourceQingcloudEIPRead,
+		Update: resourceQingcloudEIPUpdate,
+		Delete: resourceQingcloudEIPDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Update: schema.DefaultTimeout(10 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"bandwidth": {
+				Type:         schema.TypeInt,
+				Required:     true,
+				Description:  "bandwidth in Mbps",
+				ValidateFunc: validateBandwidth,
+			},
+			"billing_mode": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "bandwidth",
+				ForceNew:     true,
+				Description:  "bandwidth to be billed by bandwidth, traffic to be billed by traffic",
+				ValidateFunc: validateBillingMode,
+			},
+			"need_icp": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				ForceNew:    true,
+				Description: "whether the EIP is used by a website that needs an ICP license",
+			},
+			"addr": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"status": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+type qingcloudEIP struct {
+	EIPID       string `json:"eip_id"`
+	EIPName     string `json:"eip_name"`
+	Description string `json:"description"`
+	EIPAddr     string `json:"eip_addr"`
+	Bandwidth   int    `json:"bandwidth"`
+	BillingMode string `json:"billing_mode"`
+	NeedICP     int    `json:"need_icp"`
+	Status      string `json:"status"`
+	Resource    struct {
+		ResourceID   string `json:"resource_id"`
+		ResourceType string `json:"resource_type"`
+	} `json:"resource"`
+}
+
+func resourceQingcloudEIPCreate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	params := url.Values{}
+	params.Set("eip_name", d.Get("name").(string))
+	params.Set("bandwidth", strconv.Itoa(d.Get("bandwidth").(int)))
+	params.Set("billing_mode", d.Get("billing_mode").(string))
+	params.Set("need_icp", "0")
+	if d.Get("need_icp").(bool) {
+		params.Set("need_icp", "1")
+	}
+	params.Set("count", "1")
+	var resp struct {
+		EIPs []string `json:"eips"`
+	}
+	if err := client.Do("AllocateEips", params, &resp); err != nil {
+		return err
+	}
+	if len(resp.EIPs) == 0 {
+		return fmt.Errorf("AllocateEips did not return an EIP")
+	}
+	d.SetId(resp.EIPs[0])
+
+	if v, ok := d.GetOk("description"); ok {
+		if err := modifyEIPAttributes(client, d.Id(), d.Get("name").(string), v.(string)); err != nil {
+			return err
+		}
+	}
+
+	return resourceQingcloudEIPRead(d, meta)
+}
+
+func resourceQingcloudEIPRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	eip, err := describeEIP(client, d.Id())
+	if err != nil {
+		return err
+	}
+	if eip == nil {
+		d.SetId("")
+		return nil
+	}
+
+	d.Set("name", eip.EIPName)
+	d.Set("description", eip.Description)
+	d.Set("bandwidth", eip.Bandwidth)
+	d.Set("billing_mode", eip.BillingMode)
+	d.Set("need_icp", eip.NeedICP == 1)
+	d.Set("addr", eip.EIPAddr)
+	d.Set("status", eip.Status)
+	return nil
+}
+
+func resourceQingcloudEIPUpdate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	if d.HasChange("name") || d.HasChange("description") {
+		if err := modifyEIPAttributes(client, d.Id(), d.Get("name").(string), d.Get("description").(string)); err != nil {
+			return err
+		}
+	}
+	if d.HasChange("bandwidth") {
+		params := url.Values{}
+		setList(params, "eips", []string{d.Id()})
+		params.Set("bandwidth", strconv.Itoa(d.Get("bandwidth").(int)))
+		if err := client.DoJob("ChangeEipsBandwidth", params, d.Timeout(schema.TimeoutUpdate)); err != nil {
+			return err
+		}
+	}
+
+	return resourceQingcloudEIPRead(d, meta)
+}
+
+func resourceQingcloudEIPDelete(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	params := url.Values{}
+	setList(params, "eips", []string{d.Id()})
+	err := client.DoJob("ReleaseEips", params, d.Timeout(schema.TimeoutDelete))
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	d.SetId("")
+	return nil
+}
+
+// describeEIP returns the EIP with id, or nil if it doesn't exist anymore.
+func describeEIP(client *Client, id string) (*qingcloudEIP, error) {
+	params := url.Values{}
+	setList(params, "eips", []string{id})
+	params.Set("verbose", "1")
+	var resp struct {
+		EIPSet []*qingcloudEIP `json:"eip_set"`
+	}
+	if err := client.Do("DescribeEips", params, &resp); err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(resp.EIPSet) == 0 {
+		return nil, nil
+	}
+	eip := resp.EIPSet[0]
+	if eip.Status == eipStatusReleased || eip.Status == eipStatusCeased {
+		return nil, nil
+	}
+	return eip, nil
+}
+
+func modifyEIPAttributes(client *Client, id, name, description string) error {
+	params := url.Values{}
+	params.Set("eip", id)
+	params.Set("eip_name", name)
+	params.Set("description", description)
+	return client.Do("ModifyEipAttributes", params, nil)
+}
+
+func validateBandwidth(v interface{}, key string) (ws []string, es []error) {
+	if b := v.(int); b < 1 {
+		es = append(es, fmt.Errorf("%s: must be at least 1, got %d", key, b))
+	}
+	return
+}
+
+func validateBillingMode(v interface{}, key string) (ws []string, es []error) {
+	switch v.(string) {
+	case "bandwidth", "traffic":
+	default:
+		es = append(es, fmt.Errorf("%s: must be bandwidth or traffic, got %q", key, v))
+	}
+	return
+}
@@ -0,0 +1,140 @@
+package qingcloud
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// Types of the resources an EIP is associated with, as returned by
+// DescribeEips.
+const (
+	eipResourceInstance = "instance"
+	eipResourceRouter   = "router"
+)
+
+func resourceQingcloudEIPAssociation() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceQingcloudEIPAssociationCreate,
+		Read:   resourceQingcloudEIPAssociationRead,
+		Delete: resourceQingcloudEIPAssociationDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"eip_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"instance_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"router_id"},
+			},
+			"router_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"instance_id"},
+			},
+		},
+	}
+}
+
+func resourceQingcloudEIPAssociationCreate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	eipID := d.Get("eip_id").(string)
+	instanceID := d.Get("instance_id").(string)
+	routerID := d.Get("router_id").(string)
+	timeout := d.Timeout(schema.TimeoutCreate)
+	switch {
+	case instanceID != "":
+		params := url.Values{}
+		params.Set("eip", eipID)
+		params.Set("instance", instanceID)
+		if err := client.DoJob("AssociateEip", params, timeout); err != nil {
+			return err
+		}
+	case routerID != "":
+		// Routers are bound to EIPs through their attributes.
+		if err := setRouterEIP(client, routerID, eipID, timeout); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("either instance_id or router_id must be set")
+	}
+
+	// An EIP can only be associated with one resource at a time.
+	d.SetId(eipID)
+	return resourceQingcloudEIPAssociationRead(d, meta)
+}
+
+func resourceQingcloudEIPAssociationRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	eip, err := describeEIP(client, d.Id())
+	if err != nil {
+		return err
+	}
+	if eip == nil || eip.Resource.ResourceID == "" {
+		// The EIP was released or dissociated outside of Terraform.
+		d.SetId("")
+		return nil
+	}
+
+	d.Set("eip_id", eip.EIPID)
+	d.Set("instance_id", "")
+	d.Set("router_id", "")
+	switch eip.Resource.ResourceType {
+	case eipResourceInstance:
+		d.Set("instance_id", eip.Resource.ResourceID)
+	case eipResourceRouter:
+		d.Set("router_id", eip.Resource.ResourceID)
+	default:
+		return fmt.Errorf("EIP %s is associated with unsupported %s %s", d.Id(), eip.Resource.ResourceType, eip.Resource.ResourceID)
+	}
+	return nil
+}
+
+func resourceQingcloudEIPAssociationDelete(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	timeout := d.Timeout(schema.TimeoutDelete)
+	var err error
+	if routerID := d.Get("router_id").(string); routerID != "" {
+		err = setRouterEIP(client, routerID, "", timeout)
+	} else {
+		params := url.Values{}
+		setList(params, "eips", []string{d.Id()})
+		err = client.DoJob("DissociateEips", params, timeout)
+	}
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	d.SetId("")
+	return nil
+}
+
+// setRouterEIP binds an EIP to a router, or unbinds its EIP if eipID is
+// empty, and waits for the change to be applied.
+func setRouterEIP(client *Client, routerID, eipID string, timeout time.Duration) error {
+	params := url.Values{}
+	params.Set("router", routerID)
+	params.Set("eip", eipID)
+	if err := client.Do("ModifyRouterAttributes", params, nil); err != nil {
+		return err
+	}
+	return updateRouter(client, routerID, timeout)
+}
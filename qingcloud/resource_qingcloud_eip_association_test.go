@@ -0,0 +1,115 @@
+package qingcloud
+
+import (
+	"fmt"
+	"testing"
+
+	r "github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestQingcloudEIPAssociation(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	instances := newFakeInstances(api)
+	network := newFakeNetwork(api)
+	eips := newFakeEIPs(api, network)
+
+	config := func(target string) string {
+		return api.providerConfig() + fmt.Sprintf(`
+resource "qingcloud_instance" "web" {
+	image_id      = "xenial4x64a"
+	instance_type = "c2m4"
+	keypair_ids   = ["kp-1"]
+}
+
+resource "qingcloud_router" "main" {}
+
+resource "qingcloud_eip" "web" {
+	bandwidth = 5
+}
+
+resource "qingcloud_eip_association" "web" {
+	eip_id = "${qingcloud_eip.web.id}"
+	%s
+}
+`, target)
+	}
+	instanceConfig := config(`instance_id = "${qingcloud_instance.web.id}"`)
+	routerConfig := config(`router_id = "${qingcloud_router.main.id}"`)
+
+	var eipID, routerID string
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders(),
+		CheckDestroy: r.ComposeTestCheckFunc(
+			testQingcloudEIPsReleased(eips),
+			testQingcloudInstanceDestroyed(instances),
+			testQingcloudNetworkDestroyed(network),
+		),
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: instanceConfig,
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttrPair("qingcloud_eip_association.web", "id", "qingcloud_eip.web", "id"),
+					r.TestCheckResourceAttrPair("qingcloud_eip_association.web", "instance_id", "qingcloud_instance.web", "id"),
+					r.TestCheckResourceAttr("qingcloud_eip_association.web", "router_id", ""),
+					testQingcloudInstanceID("qingcloud_eip.web", &eipID),
+					testQingcloudRequests(api, "AssociateEip", 1),
+					testQingcloudEIPResource(eips, &eipID, eipResourceInstance),
+				),
+			},
+			r.TestStep{
+				Config:            instanceConfig,
+				ResourceName:      "qingcloud_eip_association.web",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			r.TestStep{
+				// Moving the EIP to a router dissociates it from the
+				// instance first.
+				Config: routerConfig,
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttrPair("qingcloud_eip_association.web", "router_id", "qingcloud_router.main", "id"),
+					r.TestCheckResourceAttr("qingcloud_eip_association.web", "instance_id", ""),
+					testQingcloudRequests(api, "DissociateEips", 1),
+					testQingcloudRequests(api, "UpdateRouters", 1),
+					testQingcloudEIPResource(eips, &eipID, eipResourceRouter),
+					testQingcloudInstanceID("qingcloud_router.main", &routerID),
+				),
+			},
+			r.TestStep{
+				// The router doesn't unbind the EIP it didn't bind itself.
+				Config: routerConfig,
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttrPair("qingcloud_router.main", "eip_id", "qingcloud_eip.web", "id"),
+					testQingcloudEIPResource(eips, &eipID, eipResourceRouter),
+				),
+			},
+			r.TestStep{
+				// An EIP dissociated outside of Terraform is associated
+				// again.
+				PreConfig: func() {
+					if err := eips.bindRouter(routerID, ""); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: routerConfig,
+				Check:  testQingcloudEIPResource(eips, &eipID, eipResourceRouter),
+			},
+		},
+	})
+}
+
+// testQingcloudEIPResource checks that the EIP is associated with a resource
+// of resourceType.
+func testQingcloudEIPResource(eips *fakeEIPs, id *string, resourceType string) r.TestCheckFunc {
+	return func(s *terraform.State) error {
+		eips.mu.Lock()
+		defer eips.mu.Unlock()
+		resource := eips.eips[*id]["resource"].(map[string]interface{})
+		if resource["resource_type"] != resourceType {
+			return fmt.Errorf("expected EIP %s to be associated with a %s, got %v", *id, resourceType, resource)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,130 @@
+package qingcloud
+
+import (
+	"fmt"
+	"testing"
+
+	r "github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestQingcloudEIP(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	eips := newFakeEIPs(api, nil)
+
+	config := func(name string, bandwidth int) string {
+		return api.providerConfig() + fmt.Sprintf(`
+resource "qingcloud_eip" "web" {
+	name         = %q
+	description  = "web servers"
+	bandwidth    = %d
+	billing_mode = "traffic"
+	need_icp     = true
+}
+`, name, bandwidth)
+	}
+
+	var id string
+	r.UnitTest(t, r.TestCase{
+		Providers:    testProviders(),
+		CheckDestroy: testQingcloudEIPsReleased(eips),
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: config("web", 5),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_eip.web", "name", "web"),
+					r.TestCheckResourceAttr("qingcloud_eip.web", "description", "web servers"),
+					r.TestCheckResourceAttr("qingcloud_eip.web", "bandwidth", "5"),
+					r.TestCheckResourceAttr("qingcloud_eip.web", "billing_mode", "traffic"),
+					r.TestCheckResourceAttr("qingcloud_eip.web", "need_icp", "true"),
+					r.TestCheckResourceAttr("qingcloud_eip.web", "addr", "139.198.1.1"),
+					r.TestCheckResourceAttr("qingcloud_eip.web", "status", "available"),
+					testQingcloudInstanceID("qingcloud_eip.web", &id),
+					func(s *terraform.State) error {
+						allocate := api.requests("AllocateEips")[0]
+						if allocate.Get("need_icp") != "1" || allocate.Get("billing_mode") != "traffic" {
+							return fmt.Errorf("unexpected AllocateEips parameters: %v", allocate)
+						}
+						return nil
+					},
+				),
+			},
+			r.TestStep{
+				// The bandwidth is changed in place.
+				Config: config("web-renamed", 10),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_eip.web", "name", "web-renamed"),
+					r.TestCheckResourceAttr("qingcloud_eip.web", "bandwidth", "10"),
+					testQingcloudInstanceSameID("qingcloud_eip.web", &id),
+					func(s *terraform.State) error {
+						change := api.requests("ChangeEipsBandwidth")
+						if len(change) != 1 || change[0].Get("bandwidth") != "10" || change[0].Get("eips.1") != id {
+							return fmt.Errorf("unexpected ChangeEipsBandwidth calls: %v", change)
+						}
+						return nil
+					},
+				),
+			},
+			r.TestStep{
+				// A bandwidth changed outside of Terraform is reverted.
+				PreConfig: func() { eips.set(id, "bandwidth", 1) },
+				Config:    config("web-renamed", 10),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_eip.web", "bandwidth", "10"),
+					testQingcloudInstanceSameID("qingcloud_eip.web", &id),
+					testQingcloudRequests(api, "ChangeEipsBandwidth", 2),
+				),
+			},
+			r.TestStep{
+				Config:            config("web-renamed", 10),
+				ResourceName:      "qingcloud_eip.web",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			r.TestStep{
+				// An EIP released outside of Terraform is allocated again.
+				PreConfig: func() { eips.set(id, "status", eipStatusReleased) },
+				Config:    config("web-renamed", 10),
+				Check: func(s *terraform.State) error {
+					if newID := s.RootModule().Resources["qingcloud_eip.web"].Primary.ID; newID == id {
+						return fmt.Errorf("expected a new EIP, got %s again", id)
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+func TestValidateEIPFields(t *testing.T) {
+	cases := []struct {
+		validate func(interface{}, string) ([]string, []error)
+		value    interface{}
+		valid    bool
+	}{
+		{validateBandwidth, 1, true},
+		{validateBandwidth, 0, false},
+		{validateBillingMode, "bandwidth", true},
+		{validateBillingMode, "traffic", true},
+		{validateBillingMode, "monthly", false},
+	}
+	for i, c := range cases {
+		if _, es := c.validate(c.value, "field"); (len(es) == 0) != c.valid {
+			t.Fatalf("%d: %v: expected valid to be %v, got errors %v", i, c.value, c.valid, es)
+		}
+	}
+}
+
+func testQingcloudEIPsReleased(eips *fakeEIPs) r.TestCheckFunc {
+	return func(s *terraform.State) error {
+		eips.mu.Lock()
+		defer eips.mu.Unlock()
+		for id, eip := range eips.eips {
+			if eip["status"] != eipStatusReleased {
+				return fmt.Errorf("EIP %s is still %s", id, eip["status"])
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,429 @@
+package qingcloud
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// Statuses of the instances returned by DescribeInstances.
+const (
+	instanceStatusTerminated = "terminated"
+	instanceStatusCeased     = "ceased"
+)
+
+func resourceQingcloudInstance() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceQingcloudInstanceCreate,
+		Read:   resourceQingcloudInstanceRead,
+		Update: resourceQingcloudInstanceUpdate,
+		Delete: resourceQingcloudInstanceDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"image_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"instance_type": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Computed:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"cpu", "memory"},
+			},
+			"cpu": {
+				Type:          schema.TypeInt,
+				Optional:      true,
+				Computed:      true,
+				ForceNew:      true,
+				Description:   "number of CPU cores, if instance_type is not set",
+				ConflictsWith: []string{"instance_type"},
+			},
+			"memory": {
+				Type:          schema.TypeInt,
+				Optional:      true,
+				Computed:      true,
+				ForceNew:      true,
+				Description:   "memory in MB, if instance_type is not set",
+				ConflictsWith: []string{"instance_type"},
+			},
+			"vxnets": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Computed:    true,
+				ForceNew:    true,
+				Description: "IDs of the vxnets to join, vxnet-0 for the basic network",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"keypair_ids": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Computed:    true,
+				ForceNew:    true,
+				Description: "IDs of the SSH key pairs, the first of which in lexical order is used to log in",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Set:         schema.HashString,
+			},
+			"security_group_id": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+				ForceNew: true,
+			},
+			"login_mode": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "keypair",
+				ForceNew:     true,
+				ValidateFunc: validateLoginMode,
+			},
+			"login_passwd": {
+				Type:      schema.TypeString,
+				Optional:  true,
+				Sensitive: true,
+				ForceNew:  true,
+			},
+			"user_data": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				Description:   "user data, base64 encoded before it is passed to the instance",
+				StateFunc:     userDataStateFunc,
+				ConflictsWith: []string{"user_data_base64"},
+			},
+			"user_data_base64": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				Description:   "base64 encoded user data, such as the rendered output of template_cloudinit_config",
+				StateFunc:     userDataStateFunc,
+				ValidateFunc:  validateBase64,
+				ConflictsWith: []string{"user_data"},
+			},
+			"status": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"private_ip": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "private IP address in the first vxnet",
+			},
+		},
+	}
+}
+
+type qingcloudInstance struct {
+	InstanceID   string `json:"instance_id"`
+	InstanceName string `json:"instance_name"`
+	Description  string `json:"description"`
+	InstanceType string `json:"instance_type"`
+	VCPUs        int    `json:"vcpus_current"`
+	Memory       int    `json:"memory_current"`
+	Status       string `json:"status"`
+	Image        struct {
+		ImageID string `json:"image_id"`
+	} `json:"image"`
+	VxNets []struct {
+		VxNetID   string `json:"vxnet_id"`
+		PrivateIP string `json:"private_ip"`
+	} `json:"vxnets"`
+	SecurityGroup struct {
+		SecurityGroupID string `json:"security_group_id"`
+	} `json:"security_group"`
+	KeyPairIDs []string `json:"keypair_ids"`
+}
+
+func resourceQingcloudInstanceCreate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	keypairs := stringSet(d.Get("keypair_ids"))
+	loginMode := d.Get("login_mode").(string)
+	switch {
+	case loginMode == "keypair" && len(keypairs) == 0:
+		return fmt.Errorf("keypair_ids: required when login_mode is keypair")
+	case loginMode == "passwd" && d.Get("login_passwd").(string) == "":
+		return fmt.Errorf("login_passwd: required when login_mode is passwd")
+	}
+	_, hasType := d.GetOk("instance_type")
+	_, hasCPU := d.GetOk("cpu")
+	_, hasMemory := d.GetOk("memory")
+	if !hasType && (!hasCPU || !hasMemory) {
+		return fmt.Errorf("either instance_type or both cpu and memory must be set")
+	}
+
+	params := url.Values{}
+	params.Set("image_id", d.Get("image_id").(string))
+	params.Set("count", "1")
+	params.Set("login_mode", loginMode)
+	if v, ok := d.GetOk("name"); ok {
+		params.Set("instance_name", v.(string))
+	}
+	if hasType {
+		params.Set("instance_type", d.Get("instance_type").(string))
+	} else {
+		params.Set("cpu", strconv.Itoa(d.Get("cpu").(int)))
+		params.Set("memory", strconv.Itoa(d.Get("memory").(int)))
+	}
+	setList(params, "vxnets", stringList(d.Get("vxnets")))
+	if loginMode == "keypair" {
+		params.Set("login_keypair", keypairs[0])
+	} else {
+		params.Set("login_passwd", d.Get("login_passwd").(string))
+	}
+	if v, ok := d.GetOk("security_group_id"); ok {
+		params.Set("security_group", v.(string))
+	}
+	userData := ""
+	if v, ok := d.GetOk("user_data"); ok {
+		userData = base64.StdEncoding.EncodeToString([]byte(v.(string)))
+	} else if v, ok := d.GetOk("user_data_base64"); ok {
+		userData = v.(string)
+	}
+	if userData != "" {
+		// The userdata parameters are ignored unless need_userdata is set.
+		params.Set("need_userdata", "1")
+		params.Set("userdata_type", "plain")
+		params.Set("userdata_value", userData)
+	}
+
+	var resp struct {
+		Instances []string `json:"instances"`
+		JobID     string   `json:"job_id"`
+	}
+	if err := client.Do("RunInstances", params, &resp); err != nil {
+		return err
+	}
+	if len(resp.Instances) == 0 {
+		return fmt.Errorf("RunInstances did not return an instance")
+	}
+	d.SetId(resp.Instances[0])
+
+	if err := client.WaitJob(resp.JobID, d.Timeout(schema.TimeoutCreate)); err != nil {
+		return err
+	}
+
+	// The first key pair was used to log in, attach the others.
+	if len(keypairs) > 1 {
+		params := url.Values{}
+		setList(params, "instances", []string{d.Id()})
+		setList(params, "keypairs", keypairs[1:])
+		if err := client.DoJob("AttachKeyPairs", params, d.Timeout(schema.TimeoutCreate)); err != nil {
+			return err
+		}
+	}
+
+	// The description can only be set by ModifyInstanceAttributes.
+	if v, ok := d.GetOk("description"); ok {
+		if err := modifyInstanceAttributes(client, d.Id(), d.Get("name").(string), v.(string)); err != nil {
+			return err
+		}
+	}
+
+	return resourceQingcloudInstanceRead(d, meta)
+}
+
+func resourceQingcloudInstanceRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	instance, err := describeInstance(client, d.Id())
+	if err != nil {
+		return err
+	}
+	if instance == nil {
+		// The instance was terminated outside of Terraform.
+		d.SetId("")
+		return nil
+	}
+
+	vxnets := make([]string, len(instance.VxNets))
+	privateIPs := make(map[string]string, len(instance.VxNets))
+	for i, vxnet := range instance.VxNets {
+		vxnets[i] = vxnet.VxNetID
+		privateIPs[vxnet.VxNetID] = vxnet.PrivateIP
+	}
+	// The API doesn't keep the order the vxnets were joined in.
+	vxnets = orderLike(vxnets, stringList(d.Get("vxnets")))
+	privateIP := ""
+	if len(vxnets) > 0 {
+		privateIP = privateIPs[vxnets[0]]
+	}
+
+	d.Set("name", instance.InstanceName)
+	d.Set("description", instance.Description)
+	d.Set("image_id", instance.Image.ImageID)
+	d.Set("instance_type", instance.InstanceType)
+	d.Set("cpu", instance.VCPUs)
+	d.Set("memory", instance.Memory)
+	d.Set("vxnets", vxnets)
+	d.Set("keypair_ids", instance.KeyPairIDs)
+	if _, ok := d.GetOk("login_mode"); !ok {
+		// Imported instances don't know how they were created.
+		if len(instance.KeyPairIDs) > 0 {
+			d.Set("login_mode", "keypair")
+		} else {
+			d.Set("login_mode", "passwd")
+		}
+	}
+	d.Set("security_group_id", instance.SecurityGroup.SecurityGroupID)
+	d.Set("status", instance.Status)
+	d.Set("private_ip", privateIP)
+	return nil
+}
+
+func resourceQingcloudInstanceUpdate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	if d.HasChange("name") || d.HasChange("description") {
+		err := modifyInstanceAttributes(client, d.Id(), d.Get("name").(string), d.Get("description").(string))
+		if err != nil {
+			return err
+		}
+	}
+
+	return resourceQingcloudInstanceRead(d, meta)
+}
+
+func resourceQingcloudInstanceDelete(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	params := url.Values{}
+	setList(params, "instances", []string{d.Id()})
+	err := client.DoJob("TerminateInstances", params, d.Timeout(schema.TimeoutDelete))
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	d.SetId("")
+	return nil
+}
+
+// describeInstance returns the instance with id, or nil if it doesn't exist
+// anymore.
+func describeInstance(client *Client, id string) (*qingcloudInstance, error) {
+	params := url.Values{}
+	setList(params, "instances", []string{id})
+	params.Set("verbose", "1")
+	var resp struct {
+		InstanceSet []*qingcloudInstance `json:"instance_set"`
+	}
+	if err := client.Do("DescribeInstances", params, &resp); err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(resp.InstanceSet) == 0 {
+		return nil, nil
+	}
+	instance := resp.InstanceSet[0]
+	if instance.Status == instanceStatusTerminated || instance.Status == instanceStatusCeased {
+		return nil, nil
+	}
+	return instance, nil
+}
+
+func modifyInstanceAttributes(client *Client, id, name, description string) error {
+	params := url.Values{}
+	params.Set("instance", id)
+	params.Set("instance_name", name)
+	params.Set("description", description)
+	return client.Do("ModifyInstanceAttributes", params, nil)
+}
+
+// userDataStateFunc stores a hash of the user data rather than the user data
+// itself, which can be large and contain secrets.
+func userDataStateFunc(v interface{}) string {
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return ""
+	}
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func validateBase64(v interface{}, key string) (ws []string, es []error) {
+	if _, err := base64.StdEncoding.DecodeString(v.(string)); err != nil {
+		es = append(es, fmt.Errorf("%s: must be base64 encoded: %s", key, err))
+	}
+	return
+}
+
+func validateLoginMode(v interface{}, key string) (ws []string, es []error) {
+	switch v.(string) {
+	case "keypair", "passwd":
+	default:
+		es = append(es, fmt.Errorf("%s: must be keypair or passwd, got %q", key, v))
+	}
+	return
+}
+
+// stringList returns the elements of a TypeList of strings.
+func stringList(v interface{}) []string {
+	list, _ := v.([]interface{})
+	result := make([]string, 0, len(list))
+	for _, e := range list {
+		if s, ok := e.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// stringSet returns the elements of a TypeSet of strings in lexical order.
+func stringSet(v interface{}) []string {
+	set, ok := v.(*schema.Set)
+	if !ok {
+		return nil
+	}
+	result := stringList(set.List())
+	sort.Strings(result)
+	return result
+}
+
+// orderLike returns values with the ones found in order first, in the same
+// order, followed by the others in their original order.
+func orderLike(values, order []string) []string {
+	remaining := make(map[string]bool, len(values))
+	for _, v := range values {
+		remaining[v] = true
+	}
+	result := make([]string, 0, len(values))
+	for _, v := range order {
+		if remaining[v] {
+			result = append(result, v)
+			delete(remaining, v)
+		}
+	}
+	for _, v := range values {
+		if remaining[v] {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,437 @@
+package qingcloud
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	r "github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/shonenada/terraform-provider-qingcloud/template"
+)
+
+// fakeInstances implements the instance actions of the fake API.
+type fakeInstances struct {
+	api *fakeAPI
+
+	mu        sync.Mutex
+	instances map[string]map[string]interface{}
+	userData  map[string]string
+}
+
+func newFakeInstances(api *fakeAPI) *fakeInstances {
+	f := &fakeInstances{
+		api:       api,
+		instances: map[string]map[string]interface{}{},
+		userData:  map[string]string{},
+	}
+	api.handle("RunInstances", f.run)
+	api.handle("DescribeInstances", f.describe)
+	api.handle("ModifyInstanceAttributes", f.modify)
+	api.handle("AttachKeyPairs", f.attachKeyPairs)
+	api.handle("TerminateInstances", f.terminate)
+	return f
+}
+
+func (f *fakeInstances) run(params url.Values) (map[string]interface{}, error) {
+	id := f.api.newID("i")
+	instanceType := params.Get("instance_type")
+	cpu, memory := 1, 1024
+	switch instanceType {
+	case "c2m4":
+		cpu, memory = 2, 4096
+	case "":
+		fmt.Sscan(params.Get("cpu"), &cpu)
+		fmt.Sscan(params.Get("memory"), &memory)
+	}
+
+	vxnets := []map[string]interface{}{}
+	for i, vxnet := range fakeList(params, "vxnets") {
+		vxnets = append(vxnets, map[string]interface{}{
+			"vxnet_id":   vxnet,
+			"private_ip": fmt.Sprintf("192.168.%d.2", i),
+		})
+	}
+	keypairs := []string{}
+	if kp := params.Get("login_keypair"); kp != "" {
+		keypairs = append(keypairs, kp)
+	}
+	securityGroup := params.Get("security_group")
+	if securityGroup == "" {
+		securityGroup = "sg-default"
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.instances[id] = map[string]interface{}{
+		"instance_id":    id,
+		"instance_name":  params.Get("instance_name"),
+		"description":    "",
+		"instance_type":  instanceType,
+		"vcpus_current":  cpu,
+		"memory_current": memory,
+		"status":         "running",
+		"image":          map[string]interface{}{"image_id": params.Get("image_id")},
+		"vxnets":         vxnets,
+		"security_group": map[string]interface{}{"security_group_id": securityGroup},
+		"keypair_ids":    keypairs,
+	}
+	if v := params.Get("userdata_value"); v != "" {
+		if params.Get("need_userdata") != "1" {
+			return nil, &fakeError{1100, "userdata_value: need_userdata must be 1"}
+		}
+		data, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, &fakeError{1100, "userdata_value: " + err.Error()}
+		}
+		f.userData[id] = string(data)
+	}
+	return map[string]interface{}{
+		"instances": []string{id},
+		"job_id":    f.api.startJob("RunInstances"),
+	}, nil
+}
+
+func (f *fakeInstances) describe(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	set := []map[string]interface{}{}
+	for _, id := range fakeList(params, "instances") {
+		if instance, ok := f.instances[id]; ok {
+			set = append(set, instance)
+		}
+	}
+	return map[string]interface{}{"instance_set": set, "total_count": len(set)}, nil
+}
+
+func (f *fakeInstances) modify(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	instance, ok := f.instances[params.Get("instance")]
+	if !ok {
+		return nil, &fakeError{2100, "ResourceNotFound"}
+	}
+	instance["instance_name"] = params.Get("instance_name")
+	instance["description"] = params.Get("description")
+	return nil, nil
+}
+
+func (f *fakeInstances) attachKeyPairs(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range fakeList(params, "instances") {
+		instance, ok := f.instances[id]
+		if !ok {
+			return nil, &fakeError{2100, "ResourceNotFound"}
+		}
+		instance["keypair_ids"] = append(instance["keypair_ids"].([]string), fakeList(params, "keypairs")...)
+	}
+	return map[string]interface{}{"job_id": f.api.startJob("AttachKeyPairs")}, nil
+}
+
+func (f *fakeInstances) terminate(params url.Values) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range fakeList(params, "instances") {
+		instance, ok := f.instances[id]
+		if !ok || instance["status"] == instanceStatusCeased {
+			return nil, &fakeError{2100, "ResourceNotFound"}
+		}
+		instance["status"] = instanceStatusTerminated
+	}
+	return map[string]interface{}{"job_id": f.api.startJob("TerminateInstances")}, nil
+}
+
+func (f *fakeInstances) set(id, key string, value interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.instances[id][key] = value
+}
+
+func testProviders() map[string]terraform.ResourceProvider {
+	return map[string]terraform.ResourceProvider{
+		"qingcloud": Provider(),
+		"template":  template.Provider(),
+	}
+}
+
+func TestQingcloudInstance(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	instances := newFakeInstances(api)
+
+	config := func(name string) string {
+		return api.providerConfig() + fmt.Sprintf(`
+data "template_cloudinit_config" "init" {
+	gzip = false
+
+	part {
+		content_type = "text/cloud-config"
+		content      = "hostname: web"
+	}
+}
+
+resource "qingcloud_instance" "web" {
+	name          = %q
+	description   = "web server"
+	image_id      = "xenial4x64a"
+	instance_type = "c2m4"
+	vxnets           = ["vxnet-1", "vxnet-0"]
+	keypair_ids      = ["kp-2", "kp-1"]
+	user_data_base64 = "${data.template_cloudinit_config.init.rendered}"
+}
+`, name)
+	}
+
+	var id string
+	r.UnitTest(t, r.TestCase{
+		Providers:    testProviders(),
+		CheckDestroy: testQingcloudInstanceDestroyed(instances),
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: config("web"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_instance.web", "name", "web"),
+					r.TestCheckResourceAttr("qingcloud_instance.web", "description", "web server"),
+					r.TestCheckResourceAttr("qingcloud_instance.web", "cpu", "2"),
+					r.TestCheckResourceAttr("qingcloud_instance.web", "memory", "4096"),
+					r.TestCheckResourceAttr("qingcloud_instance.web", "status", "running"),
+					r.TestCheckResourceAttr("qingcloud_instance.web", "private_ip", "192.168.0.2"),
+					r.TestCheckResourceAttr("qingcloud_instance.web", "security_group_id", "sg-default"),
+					r.TestCheckResourceAttr("qingcloud_instance.web", "keypair_ids.#", "2"),
+					r.TestCheckResourceAttr("qingcloud_instance.web", "vxnets.0", "vxnet-1"),
+					r.TestCheckResourceAttr("qingcloud_instance.web", "vxnets.1", "vxnet-0"),
+					testQingcloudInstanceID("qingcloud_instance.web", &id),
+					func(s *terraform.State) error {
+						run := api.requests("RunInstances")[0]
+						if run.Get("login_keypair") != "kp-1" || run.Get("userdata_type") != "plain" {
+							return fmt.Errorf("unexpected RunInstances parameters: %v", run)
+						}
+						// user_data_base64 is passed as is, not encoded
+						// twice.
+						if !strings.Contains(instances.userData[id], "hostname: web") {
+							return fmt.Errorf("unexpected user data: %q", instances.userData[id])
+						}
+						return nil
+					},
+				),
+			},
+			r.TestStep{
+				Config: config("web-renamed"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_instance.web", "name", "web-renamed"),
+					testQingcloudInstanceSameID("qingcloud_instance.web", &id),
+				),
+			},
+			r.TestStep{
+				// Changes made outside of Terraform are reverted.
+				PreConfig: func() { instances.set(id, "instance_name", "drifted") },
+				Config:    config("web-renamed"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_instance.web", "name", "web-renamed"),
+					testQingcloudInstanceSameID("qingcloud_instance.web", &id),
+					func(s *terraform.State) error {
+						instances.mu.Lock()
+						defer instances.mu.Unlock()
+						if name := instances.instances[id]["instance_name"]; name != "web-renamed" {
+							return fmt.Errorf("expected the drifted name to be reverted, got %q", name)
+						}
+						return nil
+					},
+				),
+			},
+			r.TestStep{
+				Config:                  config("web-renamed"),
+				ResourceName:            "qingcloud_instance.web",
+				ImportState:             true,
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"user_data_base64"},
+			},
+			r.TestStep{
+				// The order the API lists vxnets and key pairs in doesn't
+				// replace the instance.
+				PreConfig: func() {
+					instances.mu.Lock()
+					defer instances.mu.Unlock()
+					instance := instances.instances[id]
+					vxnets := instance["vxnets"].([]map[string]interface{})
+					instance["vxnets"] = []map[string]interface{}{vxnets[1], vxnets[0]}
+					keypairs := instance["keypair_ids"].([]string)
+					instance["keypair_ids"] = []string{keypairs[1], keypairs[0]}
+				},
+				Config: config("web-renamed"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_instance.web", "vxnets.0", "vxnet-1"),
+					r.TestCheckResourceAttr("qingcloud_instance.web", "private_ip", "192.168.0.2"),
+					testQingcloudInstanceSameID("qingcloud_instance.web", &id),
+				),
+			},
+			r.TestStep{
+				// An instance terminated outside of Terraform is recreated.
+				PreConfig: func() { instances.set(id, "status", instanceStatusCeased) },
+				Config:    config("web-renamed"),
+				Check: func(s *terraform.State) error {
+					newID := s.RootModule().Resources["qingcloud_instance.web"].Primary.ID
+					if newID == id {
+						return fmt.Errorf("expected a new instance, got %s again", id)
+					}
+					return nil
+				},
+			},
+		},
+	})
+
+	for _, action := range []string{"AttachKeyPairs", "ModifyInstanceAttributes", "TerminateInstances"} {
+		if len(api.requests(action)) == 0 {
+			t.Fatalf("%s was not called", action)
+		}
+	}
+}
+
+func TestQingcloudInstanceCPUMemory(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	instances := newFakeInstances(api)
+
+	r.UnitTest(t, r.TestCase{
+		Providers:    testProviders(),
+		CheckDestroy: testQingcloudInstanceDestroyed(instances),
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: api.providerConfig() + `
+resource "qingcloud_instance" "db" {
+	image_id     = "xenial4x64a"
+	cpu          = 4
+	memory       = 8192
+	login_mode   = "passwd"
+	login_passwd = "Passw0rd"
+	user_data    = "#!/bin/sh\necho hello"
+}
+`,
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_instance.db", "cpu", "4"),
+					r.TestCheckResourceAttr("qingcloud_instance.db", "memory", "8192"),
+					r.TestCheckResourceAttr("qingcloud_instance.db", "user_data", userDataStateFunc("#!/bin/sh\necho hello")),
+					func(s *terraform.State) error {
+						run := api.requests("RunInstances")[0]
+						want := url.Values{"cpu": {"4"}, "memory": {"8192"}, "login_passwd": {"Passw0rd"}}
+						for k := range want {
+							if !reflect.DeepEqual(run[k], want[k]) {
+								return fmt.Errorf("%s: expected %v, got %v", k, want[k], run[k])
+							}
+						}
+						id := s.RootModule().Resources["qingcloud_instance.db"].Primary.ID
+						if got := instances.userData[id]; got != "#!/bin/sh\necho hello" {
+							return fmt.Errorf("unexpected user data: %q", got)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestQingcloudInstanceJobFailure(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	instances := newFakeInstances(api)
+	api.handle("RunInstances", func(params url.Values) (map[string]interface{}, error) {
+		resp, err := instances.run(params)
+		if err == nil {
+			resp["job_id"] = api.startJobWithStatuses("RunInstances", jobStatusPending, jobStatusFailed)
+		}
+		return resp, err
+	})
+
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders(),
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: api.providerConfig() + `
+resource "qingcloud_instance" "web" {
+	image_id      = "xenial4x64a"
+	instance_type = "c2m4"
+	keypair_ids   = ["kp-1"]
+}
+`,
+				ExpectError: regexp.MustCompile(`error waiting for job j-\d+: RunInstances job failed`),
+			},
+		},
+	})
+}
+
+func TestValidateLoginMode(t *testing.T) {
+	for _, v := range []string{"keypair", "passwd"} {
+		if _, es := validateLoginMode(v, "login_mode"); len(es) > 0 {
+			t.Fatalf("%s: unexpected errors: %v", v, es)
+		}
+	}
+	if _, es := validateLoginMode("password", "login_mode"); len(es) != 1 {
+		t.Fatalf("expected an error for password, got %v", es)
+	}
+}
+
+func TestValidateBase64(t *testing.T) {
+	if _, es := validateBase64("I2Nsb3VkLWNvbmZpZwo=", "user_data_base64"); len(es) > 0 {
+		t.Fatalf("unexpected errors: %v", es)
+	}
+	if _, es := validateBase64("#cloud-config\n", "user_data_base64"); len(es) != 1 {
+		t.Fatalf("expected an error for plain text, got %v", es)
+	}
+}
+
+func TestOrderLike(t *testing.T) {
+	cases := []struct {
+		Values, Order, Expected []string
+	}{
+		{[]string{"a", "b", "c"}, nil, []string{"a", "b", "c"}},
+		{[]string{"a", "b", "c"}, []string{"c", "a"}, []string{"c", "a", "b"}},
+		{[]string{"a", "b"}, []string{"b", "x", "a"}, []string{"b", "a"}},
+	}
+	for i, c := range cases {
+		if got := orderLike(c.Values, c.Order); !reflect.DeepEqual(got, c.Expected) {
+			t.Fatalf("%d: expected %v, got %v", i, c.Expected, got)
+		}
+	}
+}
+
+func testQingcloudInstanceID(name string, id *string) r.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[name]
+		if !ok {
+			return fmt.Errorf("not found: %s", name)
+		}
+		*id = rs.Primary.ID
+		return nil
+	}
+}
+
+func testQingcloudInstanceSameID(name string, id *string) r.TestCheckFunc {
+	return func(s *terraform.State) error {
+		if got := s.RootModule().Resources[name].Primary.ID; got != *id {
+			return fmt.Errorf("expected %s to be updated in place, got new ID %s", *id, got)
+		}
+		return nil
+	}
+}
+
+func testQingcloudInstanceDestroyed(instances *fakeInstances) r.TestCheckFunc {
+	return func(s *terraform.State) error {
+		instances.mu.Lock()
+		defer instances.mu.Unlock()
+		for id, instance := range instances.instances {
+			switch instance["status"] {
+			case instanceStatusTerminated, instanceStatusCeased:
+			default:
+				return fmt.Errorf("instance %s is still %s", id, instance["status"])
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,515 @@
+package qingcloud
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// Statuses of the routers returned by DescribeRouters.
+const (
+	routerStatusDeleted = "deleted"
+	routerStatusCeased  = "ceased"
+)
+
+// Types of the router statics returned by DescribeRouterStatics.
+const (
+	routerStaticPortForward = 1
+	routerStaticVPN         = 2
+)
+
+func resourceQingcloudRouter() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceQingcloudRouterCreate,
+		Read:   resourceQingcloudRouterRead,
+		Update: resourceQingcloudRouterUpdate,
+		Delete: resourceQingcloudRouterDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Update: schema.DefaultTimeout(10 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"type": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     1,
+				ForceNew:    true,
+				Description: "router type, 1 for medium",
+			},
+			"vpc_network": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				Description:  "network of the VPC, such as 192.168.0.0/16",
+				ValidateFunc: validateIPNetwork,
+			},
+			"security_group_id": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"eip_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				Description: "ID of the EIP bound to the router, unless bound by qingcloud_eip_association",
+			},
+			"port_forward": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"src_port": {
+							Type:     schema.TypeInt,
+							Required: true,
+						},
+						"dst_ip": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"dst_port": {
+							Type:     schema.TypeInt,
+							Required: true,
+						},
+						"protocol": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      "tcp",
+							ValidateFunc: validateProtocol,
+						},
+					},
+				},
+			},
+			"vpn": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Description: "OpenVPN services of the router",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"port": {
+							Type:     schema.TypeInt,
+							Optional: true,
+							Default:  1194,
+						},
+						"protocol": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      "udp",
+							ValidateFunc: validateProtocol,
+						},
+						"ip_network": {
+							Type:         schema.TypeString,
+							Required:     true,
+							Description:  "network of the VPN clients",
+							ValidateFunc: validateIPNetwork,
+						},
+					},
+				},
+			},
+			"eip_addr": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"status": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+type qingcloudRouter struct {
+	RouterID        string `json:"router_id"`
+	RouterName      string `json:"router_name"`
+	Description     string `json:"description"`
+	RouterType      int    `json:"router_type"`
+	VPCNetwork      string `json:"vpc_network"`
+	SecurityGroupID string `json:"security_group_id"`
+	Status          string `json:"status"`
+	EIP             struct {
+		EIPID   string `json:"eip_id"`
+		EIPAddr string `json:"eip_addr"`
+	} `json:"eip"`
+}
+
+// routerStatic is a rule of a router, such as a port forwarding. The meaning
+// of the values depends on its type.
+type routerStatic struct {
+	ID   string `json:"router_static_id"`
+	Name string `json:"router_static_name"`
+	Type int    `json:"static_type"`
+	Val1 string `json:"val1"`
+	Val2 string `json:"val2"`
+	Val3 string `json:"val3"`
+	Val4 string `json:"val4"`
+}
+
+// managed reports whether the static is one of the port forwardings or
+// OpenVPN services managed by qingcloud_router. Other statics, such as PPTP
+// or IPsec VPNs, are left alone.
+func (s routerStatic) managed() bool {
+	return s.Type == routerStaticPortForward || s.Type == routerStaticVPN && s.Val1 == "openvpn"
+}
+
+// key identifies a static by everything but its ID.
+func (s routerStatic) key() string {
+	return strings.Join([]string{strconv.Itoa(s.Type), s.Name, s.Val1, s.Val2, s.Val3, s.Val4}, "|")
+}
+
+func resourceQingcloudRouterCreate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	params := url.Values{}
+	params.Set("router_name", d.Get("name").(string))
+	params.Set("router_type", strconv.Itoa(d.Get("type").(int)))
+	params.Set("count", "1")
+	if v, ok := d.GetOk("vpc_network"); ok {
+		params.Set("vpc_network", v.(string))
+	}
+	if v, ok := d.GetOk("security_group_id"); ok {
+		params.Set("security_group", v.(string))
+	}
+	var resp struct {
+		Routers []string `json:"routers"`
+		JobID   string   `json:"job_id"`
+	}
+	if err := client.Do("CreateRouters", params, &resp); err != nil {
+		return err
+	}
+	if len(resp.Routers) == 0 {
+		return fmt.Errorf("CreateRouters did not return a router")
+	}
+	d.SetId(resp.Routers[0])
+
+	if err := client.WaitJob(resp.JobID, d.Timeout(schema.TimeoutCreate)); err != nil {
+		return err
+	}
+
+	_, hasDescription := d.GetOk("description")
+	_, hasEIP := d.GetOk("eip_id")
+	modified := hasDescription || hasEIP
+	if modified {
+		if err := modifyRouterAttributes(client, d); err != nil {
+			return err
+		}
+	}
+	statics := desiredRouterStatics(d)
+	if len(statics) > 0 {
+		if err := addRouterStatics(client, d.Id(), statics); err != nil {
+			return err
+		}
+		modified = true
+	}
+	if modified {
+		if err := updateRouter(client, d.Id(), d.Timeout(schema.TimeoutCreate)); err != nil {
+			return err
+		}
+	}
+
+	return resourceQingcloudRouterRead(d, meta)
+}
+
+func resourceQingcloudRouterRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	router, err := describeRouter(client, d.Id())
+	if err != nil {
+		return err
+	}
+	if router == nil {
+		d.SetId("")
+		return nil
+	}
+	statics, err := describeRouterStatics(client, d.Id())
+	if err != nil {
+		return err
+	}
+
+	var portForwards, vpns []interface{}
+	for _, s := range statics {
+		if !s.managed() {
+			continue
+		}
+		switch s.Type {
+		case routerStaticPortForward:
+			srcPort, _ := strconv.Atoi(s.Val1)
+			dstPort, _ := strconv.Atoi(s.Val3)
+			portForwards = append(portForwards, map[string]interface{}{
+				"name":     s.Name,
+				"src_port": srcPort,
+				"dst_ip":   s.Val2,
+				"dst_port": dstPort,
+				"protocol": s.Val4,
+			})
+		case routerStaticVPN:
+			port, _ := strconv.Atoi(s.Val2)
+			vpns = append(vpns, map[string]interface{}{
+				"port":       port,
+				"protocol":   s.Val3,
+				"ip_network": s.Val4,
+			})
+		}
+	}
+
+	d.Set("name", router.RouterName)
+	d.Set("description", router.Description)
+	d.Set("type", router.RouterType)
+	d.Set("vpc_network", router.VPCNetwork)
+	d.Set("security_group_id", router.SecurityGroupID)
+	d.Set("eip_id", router.EIP.EIPID)
+	d.Set("eip_addr", router.EIP.EIPAddr)
+	d.Set("status", router.Status)
+	if err := d.Set("port_forward", portForwards); err != nil {
+		return err
+	}
+	if err := d.Set("vpn", vpns); err != nil {
+		return err
+	}
+	return nil
+}
+
+func resourceQingcloudRouterUpdate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	modified := false
+	if d.HasChange("name") || d.HasChange("description") || d.HasChange("security_group_id") || d.HasChange("eip_id") {
+		if err := modifyRouterAttributes(client, d); err != nil {
+			return err
+		}
+		modified = true
+	}
+
+	if d.HasChange("port_forward") || d.HasChange("vpn") {
+		changed, err := reconcileRouterStatics(client, d.Id(), desiredRouterStatics(d))
+		if err != nil {
+			return err
+		}
+		modified = modified || changed
+	}
+
+	// Changes to a router only take effect once applied by UpdateRouters.
+	if modified {
+		if err := updateRouter(client, d.Id(), d.Timeout(schema.TimeoutUpdate)); err != nil {
+			return err
+		}
+	}
+
+	return resourceQingcloudRouterRead(d, meta)
+}
+
+func resourceQingcloudRouterDelete(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	// The API would leave the joined vxnets without a router, so refuse to
+	// delete it until they have left.
+	vxnets, err := routerVxnets(client, d.Id(), "")
+	if err != nil {
+		if isNotFound(err) {
+			d.SetId("")
+			return nil
+		}
+		return err
+	}
+	if len(vxnets) > 0 {
+		ids := make([]string, 0, len(vxnets))
+		for id := range vxnets {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return fmt.Errorf("router %s can't be deleted while vxnets are joined: %s", d.Id(), strings.Join(ids, ", "))
+	}
+
+	params := url.Values{}
+	setList(params, "routers", []string{d.Id()})
+	err = client.DoJob("DeleteRouters", params, d.Timeout(schema.TimeoutDelete))
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	d.SetId("")
+	return nil
+}
+
+// describeRouter returns the router with id, or nil if it doesn't exist
+// anymore.
+func describeRouter(client *Client, id string) (*qingcloudRouter, error) {
+	params := url.Values{}
+	setList(params, "routers", []string{id})
+	params.Set("verbose", "1")
+	var resp struct {
+		RouterSet []*qingcloudRouter `json:"router_set"`
+	}
+	if err := client.Do("DescribeRouters", params, &resp); err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(resp.RouterSet) == 0 {
+		return nil, nil
+	}
+	router := resp.RouterSet[0]
+	if router.Status == routerStatusDeleted || router.Status == routerStatusCeased {
+		return nil, nil
+	}
+	return router, nil
+}
+
+func modifyRouterAttributes(client *Client, d *schema.ResourceData) error {
+	params := url.Values{}
+	params.Set("router", d.Id())
+	params.Set("router_name", d.Get("name").(string))
+	params.Set("description", d.Get("description").(string))
+	// The EIP may be bound by qingcloud_eip_association instead, so only
+	// send it when it is changed in the configuration.
+	if d.HasChange("eip_id") {
+		params.Set("eip", d.Get("eip_id").(string))
+	}
+	if v, ok := d.GetOk("security_group_id"); ok {
+		params.Set("security_group", v.(string))
+	}
+	return client.Do("ModifyRouterAttributes", params, nil)
+}
+
+func updateRouter(client *Client, id string, timeout time.Duration) error {
+	params := url.Values{}
+	setList(params, "routers", []string{id})
+	return client.DoJob("UpdateRouters", params, timeout)
+}
+
+func describeRouterStatics(client *Client, routerID string) ([]routerStatic, error) {
+	params := url.Values{}
+	params.Set("router", routerID)
+	var resp struct {
+		RouterStaticSet []routerStatic `json:"router_static_set"`
+	}
+	if err := client.Do("DescribeRouterStatics", params, &resp); err != nil {
+		return nil, err
+	}
+	return resp.RouterStaticSet, nil
+}
+
+// desiredRouterStatics returns the statics of the port_forward and vpn blocks.
+func desiredRouterStatics(d *schema.ResourceData) []routerStatic {
+	var statics []routerStatic
+	for _, v := range d.Get("port_forward").(*schema.Set).List() {
+		m := v.(map[string]interface{})
+		statics = append(statics, routerStatic{
+			Name: m["name"].(string),
+			Type: routerStaticPortForward,
+			Val1: strconv.Itoa(m["src_port"].(int)),
+			Val2: m["dst_ip"].(string),
+			Val3: strconv.Itoa(m["dst_port"].(int)),
+			Val4: m["protocol"].(string),
+		})
+	}
+	for _, v := range d.Get("vpn").(*schema.Set).List() {
+		m := v.(map[string]interface{})
+		statics = append(statics, routerStatic{
+			Type: routerStaticVPN,
+			Val1: "openvpn",
+			Val2: strconv.Itoa(m["port"].(int)),
+			Val3: m["protocol"].(string),
+			Val4: m["ip_network"].(string),
+		})
+	}
+	return statics
+}
+
+// reconcileRouterStatics deletes the port forwarding and OpenVPN statics of
+// the router that aren't desired and adds the missing ones, leaving other
+// statics alone. It reports whether it changed anything.
+func reconcileRouterStatics(client *Client, routerID string, desired []routerStatic) (bool, error) {
+	current, err := describeRouterStatics(client, routerID)
+	if err != nil {
+		return false, err
+	}
+
+	want := map[string]bool{}
+	for _, s := range desired {
+		want[s.key()] = true
+	}
+	have := map[string]bool{}
+	var remove []string
+	for _, s := range current {
+		if !s.managed() {
+			continue
+		}
+		if want[s.key()] && !have[s.key()] {
+			have[s.key()] = true
+			continue
+		}
+		remove = append(remove, s.ID)
+	}
+	var add []routerStatic
+	for _, s := range desired {
+		if !have[s.key()] {
+			add = append(add, s)
+		}
+	}
+
+	if len(remove) > 0 {
+		params := url.Values{}
+		setList(params, "router_statics", remove)
+		if err := client.Do("DeleteRouterStatics", params, nil); err != nil {
+			return false, err
+		}
+	}
+	if len(add) > 0 {
+		if err := addRouterStatics(client, routerID, add); err != nil {
+			return false, err
+		}
+	}
+	return len(remove) > 0 || len(add) > 0, nil
+}
+
+func addRouterStatics(client *Client, routerID string, statics []routerStatic) error {
+	params := url.Values{}
+	params.Set("router", routerID)
+	for i, s := range statics {
+		prefix := fmt.Sprintf("statics.%d.", i+1)
+		params.Set(prefix+"static_type", strconv.Itoa(s.Type))
+		if s.Name != "" {
+			params.Set(prefix+"router_static_name", s.Name)
+		}
+		params.Set(prefix+"val1", s.Val1)
+		params.Set(prefix+"val2", s.Val2)
+		params.Set(prefix+"val3", s.Val3)
+		params.Set(prefix+"val4", s.Val4)
+	}
+	return client.Do("AddRouterStatics", params, nil)
+}
+
+func validateProtocol(v interface{}, key string) (ws []string, es []error) {
+	switch v.(string) {
+	case "tcp", "udp":
+	default:
+		es = append(es, fmt.Errorf("%s: must be tcp or udp, got %q", key, v))
+	}
+	return
+}
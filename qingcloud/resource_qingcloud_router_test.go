@@ -0,0 +1,241 @@
+package qingcloud
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	r "github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestQingcloudRouter(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	network := newFakeNetwork(api)
+
+	config := func(name, sshPort string) string {
+		return api.providerConfig() + fmt.Sprintf(`
+resource "qingcloud_router" "main" {
+	name        = %q
+	description = "main router"
+	vpc_network = "192.168.0.0/16"
+	eip_id      = "eip-1"
+
+	port_forward {
+		name     = "ssh"
+		src_port = %s
+		dst_ip   = "192.168.1.2"
+		dst_port = 22
+	}
+
+	port_forward {
+		name     = "dns"
+		src_port = 53
+		dst_ip   = "192.168.1.3"
+		dst_port = 53
+		protocol = "udp"
+	}
+
+	vpn {
+		ip_network = "10.255.0.0/24"
+	}
+}
+`, name, sshPort)
+	}
+
+	var id string
+	r.UnitTest(t, r.TestCase{
+		Providers:    testProviders(),
+		CheckDestroy: testQingcloudNetworkDestroyed(network),
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: config("main", "2222"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_router.main", "name", "main"),
+					r.TestCheckResourceAttr("qingcloud_router.main", "description", "main router"),
+					r.TestCheckResourceAttr("qingcloud_router.main", "vpc_network", "192.168.0.0/16"),
+					r.TestCheckResourceAttr("qingcloud_router.main", "security_group_id", "sg-default"),
+					r.TestCheckResourceAttr("qingcloud_router.main", "eip_id", "eip-1"),
+					r.TestCheckResourceAttr("qingcloud_router.main", "eip_addr", "139.198.0.1"),
+					r.TestCheckResourceAttr("qingcloud_router.main", "status", "active"),
+					r.TestCheckResourceAttr("qingcloud_router.main", "port_forward.#", "2"),
+					r.TestCheckResourceAttr("qingcloud_router.main", "vpn.#", "1"),
+					testQingcloudInstanceID("qingcloud_router.main", &id),
+					func(s *terraform.State) error {
+						add := api.requests("AddRouterStatics")
+						if len(add) != 1 || add[0].Get("statics.3.static_type") != "2" || add[0].Get("statics.3.val1") != "openvpn" {
+							return fmt.Errorf("unexpected AddRouterStatics calls: %v", add)
+						}
+						if n := len(api.requests("UpdateRouters")); n != 1 {
+							return fmt.Errorf("expected 1 UpdateRouters call, got %d", n)
+						}
+						return nil
+					},
+				),
+			},
+			r.TestStep{
+				// Only the changed port forwarding is replaced.
+				Config: config("main-renamed", "2200"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_router.main", "name", "main-renamed"),
+					r.TestCheckResourceAttr("qingcloud_router.main", "port_forward.#", "2"),
+					testQingcloudInstanceSameID("qingcloud_router.main", &id),
+					func(s *terraform.State) error {
+						del := api.requests("DeleteRouterStatics")
+						if len(del) != 1 || len(fakeList(del[0], "router_statics")) != 1 {
+							return fmt.Errorf("unexpected DeleteRouterStatics calls: %v", del)
+						}
+						add := api.requests("AddRouterStatics")
+						if len(add) != 2 || add[1].Get("statics.1.val1") != "2200" || add[1].Get("statics.2.static_type") != "" {
+							return fmt.Errorf("unexpected AddRouterStatics calls: %v", add)
+						}
+						if n := len(api.requests("UpdateRouters")); n != 2 {
+							return fmt.Errorf("expected 2 UpdateRouters calls, got %d", n)
+						}
+						// The unchanged EIP isn't sent again.
+						modify := api.requests("ModifyRouterAttributes")
+						if _, ok := modify[len(modify)-1]["eip"]; ok {
+							return fmt.Errorf("unexpected eip in ModifyRouterAttributes: %v", modify[len(modify)-1])
+						}
+						return nil
+					},
+				),
+			},
+			r.TestStep{
+				// Statics and attributes changed outside of Terraform are
+				// reverted.
+				PreConfig: func() {
+					network.setRouter(id, "router_name", "drifted")
+					network.addStatic(id, map[string]interface{}{
+						"router_static_id": "rtrs-drifted",
+						"static_type":      routerStaticPortForward,
+						"val1":             "80",
+						"val2":             "192.168.1.9",
+						"val3":             "80",
+						"val4":             "tcp",
+					})
+				},
+				Config: config("main-renamed", "2200"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_router.main", "name", "main-renamed"),
+					r.TestCheckResourceAttr("qingcloud_router.main", "port_forward.#", "2"),
+					func(s *terraform.State) error {
+						network.mu.Lock()
+						defer network.mu.Unlock()
+						if n := len(network.statics[id]); n != 3 {
+							return fmt.Errorf("expected 3 statics, got %d", n)
+						}
+						return nil
+					},
+				),
+			},
+			r.TestStep{
+				// Statics that aren't managed by the router, such as PPTP
+				// VPNs, are kept when port forwardings change.
+				PreConfig: func() {
+					network.addStatic(id, map[string]interface{}{
+						"router_static_id": "rtrs-pptp",
+						"static_type":      routerStaticVPN,
+						"val1":             "pptp",
+						"val2":             "vpn:Passw0rd",
+						"val3":             "253",
+						"val4":             "10.255.1.0/24",
+					})
+				},
+				Config: config("main-renamed", "2222"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_router.main", "port_forward.#", "2"),
+					r.TestCheckResourceAttr("qingcloud_router.main", "vpn.#", "1"),
+					func(s *terraform.State) error {
+						network.mu.Lock()
+						defer network.mu.Unlock()
+						for _, static := range network.statics[id] {
+							if static["router_static_id"] == "rtrs-pptp" {
+								return nil
+							}
+						}
+						return fmt.Errorf("expected the PPTP static to be kept, got %v", network.statics[id])
+					},
+				),
+			},
+			r.TestStep{
+				Config:            config("main-renamed", "2222"),
+				ResourceName:      "qingcloud_router.main",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			r.TestStep{
+				// A router deleted outside of Terraform is recreated.
+				PreConfig: func() { network.setRouter(id, "status", routerStatusCeased) },
+				Config:    config("main-renamed", "2222"),
+				Check: func(s *terraform.State) error {
+					if newID := s.RootModule().Resources["qingcloud_router.main"].Primary.ID; newID == id {
+						return fmt.Errorf("expected a new router, got %s again", id)
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+func TestQingcloudRouterJoinedVxnets(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	network := newFakeNetwork(api)
+
+	var id, vxnetID string
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders(),
+		CheckDestroy: func(s *terraform.State) error {
+			network.mu.Lock()
+			delete(network.vxnets, vxnetID)
+			network.mu.Unlock()
+			return testQingcloudNetworkDestroyed(network)(s)
+		},
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: api.providerConfig() + `
+resource "qingcloud_router" "main" {}
+`,
+				Check: testQingcloudInstanceID("qingcloud_router.main", &id),
+			},
+			r.TestStep{
+				// A router can't be deleted while a vxnet is joined to it,
+				// even one that isn't managed by Terraform.
+				PreConfig: func() {
+					vxnetID = network.newVxnet()
+					if err := network.join(vxnetID, id, "192.168.1.0/24"); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config:      api.providerConfig(),
+				ExpectError: regexp.MustCompile(`router rtr-\d+ can't be deleted while vxnets are joined: vxnet-\d+`),
+			},
+			r.TestStep{
+				PreConfig: func() {
+					if err := network.leave(vxnetID, id); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: api.providerConfig(),
+			},
+		},
+	})
+
+	if n := len(api.requests("DeleteRouters")); n != 1 {
+		t.Fatalf("expected 1 DeleteRouters call, got %d", n)
+	}
+}
+
+func TestValidateProtocol(t *testing.T) {
+	for _, v := range []string{"tcp", "udp"} {
+		if _, es := validateProtocol(v, "protocol"); len(es) > 0 {
+			t.Fatalf("%s: unexpected errors: %v", v, es)
+		}
+	}
+	if _, es := validateProtocol("icmp", "protocol"); len(es) != 1 {
+		t.Fatalf("expected an error for icmp, got %v", es)
+	}
+}
@@ -0,0 +1,444 @@
+package qingcloud
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func resourceQingcloudSecurityGroup() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceQingcloudSecurityGroupCreate,
+		Read:   resourceQingcloudSecurityGroupRead,
+		Update: resourceQingcloudSecurityGroupUpdate,
+		Delete: resourceQingcloudSecurityGroupDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Update: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"rule": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Computed:    true,
+				Description: "rules of the security group, if they aren't managed by qingcloud_security_group_rule",
+				Elem: &schema.Resource{
+					Schema: securityGroupRuleSchema(false),
+				},
+			},
+		},
+	}
+}
+
+// securityGroupRuleSchema returns the schema of the fields of a rule, shared by
+// the rule blocks of qingcloud_security_group and qingcloud_security_group_rule.
+func securityGroupRuleSchema(forceNew bool) map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"name": {
+			Type:     schema.TypeString,
+			Optional: true,
+			ForceNew: forceNew,
+		},
+		"protocol": {
+			Type:        schema.TypeString,
+			Required:    true,
+			ForceNew:    forceNew,
+			Description: "protocol the rule matches, such as tcp, udp or icmp",
+		},
+		"priority": {
+			Type:         schema.TypeInt,
+			Optional:     true,
+			Default:      0,
+			ForceNew:     forceNew,
+			Description:  "priority of the rule from 0 to 100, rules with lower values match first",
+			ValidateFunc: validateRulePriority,
+		},
+		"action": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			Default:      "accept",
+			ForceNew:     forceNew,
+			ValidateFunc: validateRuleAction,
+		},
+		"direction": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			Default:      "ingress",
+			ForceNew:     forceNew,
+			ValidateFunc: validateRuleDirection,
+		},
+		"from_port": {
+			Type:        schema.TypeString,
+			Optional:    true,
+			ForceNew:    forceNew,
+			Description: "first port of the rule, or the ICMP type",
+		},
+		"to_port": {
+			Type:        schema.TypeString,
+			Optional:    true,
+			ForceNew:    forceNew,
+			Description: "last port of the rule, or the ICMP code",
+		},
+		"ip_network": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			ForceNew:     forceNew,
+			Description:  "network the rule matches, such as 10.0.0.0/8, or any network if empty",
+			ValidateFunc: validateIPNetwork,
+		},
+	}
+}
+
+type qingcloudSecurityGroup struct {
+	SecurityGroupID   string `json:"security_group_id"`
+	SecurityGroupName string `json:"security_group_name"`
+	Description       string `json:"description"`
+}
+
+// securityGroupRule is a rule as returned by DescribeSecurityGroupRules. For
+// TCP and UDP, Val1 and Val2 are the port range, for ICMP the type and code.
+// Val3 is the network the rule matches.
+type securityGroupRule struct {
+	ID              string `json:"security_group_rule_id"`
+	SecurityGroupID string `json:"security_group_id"`
+	Name            string `json:"security_group_rule_name"`
+	Protocol        string `json:"protocol"`
+	Priority        int    `json:"priority"`
+	Action          string `json:"action"`
+	Direction       int    `json:"direction"`
+	Val1            string `json:"val1"`
+	Val2            string `json:"val2"`
+	Val3            string `json:"val3"`
+}
+
+// key identifies a rule by everything but its ID.
+func (r securityGroupRule) key() string {
+	return strings.Join([]string{r.Name, r.Protocol, strconv.Itoa(r.Priority), r.Action, strconv.Itoa(r.Direction), r.Val1, r.Val2, r.Val3}, "|")
+}
+
+// securityGroupRuleFromMap returns the rule of the fields of a rule block or
+// of qingcloud_security_group_rule.
+func securityGroupRuleFromMap(m map[string]interface{}) securityGroupRule {
+	direction := 0
+	if m["direction"].(string) == "egress" {
+		direction = 1
+	}
+	return securityGroupRule{
+		Name:      m["name"].(string),
+		Protocol:  m["protocol"].(string),
+		Priority:  m["priority"].(int),
+		Action:    m["action"].(string),
+		Direction: direction,
+		Val1:      m["from_port"].(string),
+		Val2:      m["to_port"].(string),
+		Val3:      m["ip_network"].(string),
+	}
+}
+
+func (r securityGroupRule) fields() map[string]interface{} {
+	direction := "ingress"
+	if r.Direction == 1 {
+		direction = "egress"
+	}
+	return map[string]interface{}{
+		"name":       r.Name,
+		"protocol":   r.Protocol,
+		"priority":   r.Priority,
+		"action":     r.Action,
+		"direction":  direction,
+		"from_port":  r.Val1,
+		"to_port":    r.Val2,
+		"ip_network": r.Val3,
+	}
+}
+
+func resourceQingcloudSecurityGroupCreate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	params := url.Values{}
+	params.Set("security_group_name", d.Get("name").(string))
+	var resp struct {
+		SecurityGroupID string `json:"security_group_id"`
+	}
+	if err := client.Do("CreateSecurityGroup", params, &resp); err != nil {
+		return err
+	}
+	d.SetId(resp.SecurityGroupID)
+
+	if v, ok := d.GetOk("description"); ok {
+		if err := modifySecurityGroupAttributes(client, d.Id(), d.Get("name").(string), v.(string)); err != nil {
+			return err
+		}
+	}
+	if v, ok := d.GetOk("rule"); ok {
+		if err := reconcileSecurityGroupRules(client, d.Id(), ruleSet(v.(*schema.Set)), d.Timeout(schema.TimeoutCreate)); err != nil {
+			return err
+		}
+	}
+
+	return resourceQingcloudSecurityGroupRead(d, meta)
+}
+
+func resourceQingcloudSecurityGroupRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	group, err := describeSecurityGroup(client, d.Id())
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		d.SetId("")
+		return nil
+	}
+	rules, err := describeSecurityGroupRules(client, d.Id(), nil)
+	if err != nil {
+		return err
+	}
+
+	ruleFields := make([]interface{}, len(rules))
+	for i, rule := range rules {
+		ruleFields[i] = rule.fields()
+	}
+
+	d.Set("name", group.SecurityGroupName)
+	d.Set("description", group.Description)
+	if err := d.Set("rule", ruleFields); err != nil {
+		return err
+	}
+	return nil
+}
+
+func resourceQingcloudSecurityGroupUpdate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	if d.HasChange("name") || d.HasChange("description") {
+		if err := modifySecurityGroupAttributes(client, d.Id(), d.Get("name").(string), d.Get("description").(string)); err != nil {
+			return err
+		}
+	}
+	if d.HasChange("rule") {
+		if err := reconcileSecurityGroupRules(client, d.Id(), ruleSet(d.Get("rule").(*schema.Set)), d.Timeout(schema.TimeoutUpdate)); err != nil {
+			return err
+		}
+	}
+
+	return resourceQingcloudSecurityGroupRead(d, meta)
+}
+
+func resourceQingcloudSecurityGroupDelete(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	params := url.Values{}
+	setList(params, "security_groups", []string{d.Id()})
+	if err := client.Do("DeleteSecurityGroups", params, nil); err != nil && !isNotFound(err) {
+		return err
+	}
+
+	d.SetId("")
+	return nil
+}
+
+// describeSecurityGroup returns the security group with id, or nil if it
+// doesn't exist anymore.
+func describeSecurityGroup(client *Client, id string) (*qingcloudSecurityGroup, error) {
+	params := url.Values{}
+	setList(params, "security_groups", []string{id})
+	params.Set("verbose", "1")
+	var resp struct {
+		SecurityGroupSet []*qingcloudSecurityGroup `json:"security_group_set"`
+	}
+	if err := client.Do("DescribeSecurityGroups", params, &resp); err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(resp.SecurityGroupSet) == 0 {
+		return nil, nil
+	}
+	return resp.SecurityGroupSet[0], nil
+}
+
+func modifySecurityGroupAttributes(client *Client, id, name, description string) error {
+	params := url.Values{}
+	params.Set("security_group", id)
+	params.Set("security_group_name", name)
+	params.Set("description", description)
+	return client.Do("ModifySecurityGroupAttributes", params, nil)
+}
+
+// describeSecurityGroupRules returns the rules of a security group, only
+// those with ruleIDs if any are given.
+func describeSecurityGroupRules(client *Client, groupID string, ruleIDs []string) ([]securityGroupRule, error) {
+	params := url.Values{}
+	if groupID != "" {
+		params.Set("security_group", groupID)
+	}
+	setList(params, "security_group_rules", ruleIDs)
+	var resp struct {
+		SecurityGroupRuleSet []securityGroupRule `json:"security_group_rule_set"`
+	}
+	if err := client.Do("DescribeSecurityGroupRules", params, &resp); err != nil {
+		return nil, err
+	}
+	return resp.SecurityGroupRuleSet, nil
+}
+
+func addSecurityGroupRules(client *Client, groupID string, rules []securityGroupRule) ([]string, error) {
+	params := url.Values{}
+	params.Set("security_group", groupID)
+	for i, rule := range rules {
+		prefix := fmt.Sprintf("rules.%d.", i+1)
+		if rule.Name != "" {
+			params.Set(prefix+"security_group_rule_name", rule.Name)
+		}
+		params.Set(prefix+"protocol", rule.Protocol)
+		params.Set(prefix+"priority", strconv.Itoa(rule.Priority))
+		params.Set(prefix+"action", rule.Action)
+		params.Set(prefix+"direction", strconv.Itoa(rule.Direction))
+		params.Set(prefix+"val1", rule.Val1)
+		params.Set(prefix+"val2", rule.Val2)
+		params.Set(prefix+"val3", rule.Val3)
+	}
+	var resp struct {
+		SecurityGroupRules []string `json:"security_group_rules"`
+	}
+	if err := client.Do("AddSecurityGroupRules", params, &resp); err != nil {
+		return nil, err
+	}
+	return resp.SecurityGroupRules, nil
+}
+
+func deleteSecurityGroupRules(client *Client, ruleIDs []string) error {
+	params := url.Values{}
+	setList(params, "security_group_rules", ruleIDs)
+	return client.Do("DeleteSecurityGroupRules", params, nil)
+}
+
+// applySecurityGroup applies the rules of a security group to its instances.
+// Rule changes have no effect until then.
+func applySecurityGroup(client *Client, groupID string, timeout time.Duration) error {
+	params := url.Values{}
+	params.Set("security_group", groupID)
+	return client.DoJob("ApplySecurityGroup", params, timeout)
+}
+
+// reconcileSecurityGroupRules deletes the rules of a security group that
+// aren't desired, adds the missing ones and applies the security group if
+// anything changed.
+func reconcileSecurityGroupRules(client *Client, groupID string, desired []securityGroupRule, timeout time.Duration) error {
+	unlock := lockSecurityGroup(groupID)
+	defer unlock()
+
+	current, err := describeSecurityGroupRules(client, groupID, nil)
+	if err != nil {
+		return err
+	}
+
+	want := map[string]bool{}
+	for _, rule := range desired {
+		want[rule.key()] = true
+	}
+	have := map[string]bool{}
+	var remove []string
+	for _, rule := range current {
+		if want[rule.key()] && !have[rule.key()] {
+			have[rule.key()] = true
+			continue
+		}
+		remove = append(remove, rule.ID)
+	}
+	var add []securityGroupRule
+	for _, rule := range desired {
+		if !have[rule.key()] {
+			add = append(add, rule)
+			have[rule.key()] = true
+		}
+	}
+	if len(remove) == 0 && len(add) == 0 {
+		return nil
+	}
+
+	if len(remove) > 0 {
+		if err := deleteSecurityGroupRules(client, remove); err != nil {
+			return err
+		}
+	}
+	if len(add) > 0 {
+		if _, err := addSecurityGroupRules(client, groupID, add); err != nil {
+			return err
+		}
+	}
+	return applySecurityGroup(client, groupID, timeout)
+}
+
+func ruleSet(set *schema.Set) []securityGroupRule {
+	var rules []securityGroupRule
+	for _, v := range set.List() {
+		rules = append(rules, securityGroupRuleFromMap(v.(map[string]interface{})))
+	}
+	return rules
+}
+
+// securityGroupLocks serializes the changes to the rules of each security
+// group, as the standalone rules of a group are created in parallel.
+var securityGroupLocks = struct {
+	sync.Mutex
+	m map[string]*sync.Mutex
+}{m: map[string]*sync.Mutex{}}
+
+func lockSecurityGroup(id string) (unlock func()) {
+	securityGroupLocks.Lock()
+	l, ok := securityGroupLocks.m[id]
+	if !ok {
+		l = &sync.Mutex{}
+		securityGroupLocks.m[id] = l
+	}
+	securityGroupLocks.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+func validateRulePriority(v interface{}, key string) (ws []string, es []error) {
+	if p := v.(int); p < 0 || p > 100 {
+		es = append(es, fmt.Errorf("%s: must be between 0 and 100, got %d", key, p))
+	}
+	return
+}
+
+func validateRuleAction(v interface{}, key string) (ws []string, es []error) {
+	switch v.(string) {
+	case "accept", "drop":
+	default:
+		es = append(es, fmt.Errorf("%s: must be accept or drop, got %q", key, v))
+	}
+	return
+}
+
+func validateRuleDirection(v interface{}, key string) (ws []string, es []error) {
+	switch v.(string) {
+	case "ingress", "egress":
+	default:
+		es = append(es, fmt.Errorf("%s: must be ingress or egress, got %q", key, v))
+	}
+	return
+}
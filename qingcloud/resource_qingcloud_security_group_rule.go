@@ -0,0 +1,114 @@
+package qingcloud
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func resourceQingcloudSecurityGroupRule() *schema.Resource {
+	s := securityGroupRuleSchema(true)
+	s["security_group_id"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Required: true,
+		ForceNew: true,
+	}
+
+	return &schema.Resource{
+		Create: resourceQingcloudSecurityGroupRuleCreate,
+		Read:   resourceQingcloudSecurityGroupRuleRead,
+		Delete: resourceQingcloudSecurityGroupRuleDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: s,
+	}
+}
+
+func resourceQingcloudSecurityGroupRuleCreate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	groupID := d.Get("security_group_id").(string)
+	rule := securityGroupRuleFromMap(map[string]interface{}{
+		"name":       d.Get("name"),
+		"protocol":   d.Get("protocol"),
+		"priority":   d.Get("priority"),
+		"action":     d.Get("action"),
+		"direction":  d.Get("direction"),
+		"from_port":  d.Get("from_port"),
+		"to_port":    d.Get("to_port"),
+		"ip_network": d.Get("ip_network"),
+	})
+
+	unlock := lockSecurityGroup(groupID)
+	defer unlock()
+
+	ids, err := addSecurityGroupRules(client, groupID, []securityGroupRule{rule})
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("AddSecurityGroupRules did not return a rule")
+	}
+	d.SetId(ids[0])
+
+	if err := applySecurityGroup(client, groupID, d.Timeout(schema.TimeoutCreate)); err != nil {
+		return err
+	}
+
+	return resourceQingcloudSecurityGroupRuleRead(d, meta)
+}
+
+func resourceQingcloudSecurityGroupRuleRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	rules, err := describeSecurityGroupRules(client, "", []string{d.Id()})
+	if err != nil {
+		if isNotFound(err) {
+			d.SetId("")
+			return nil
+		}
+		return err
+	}
+	if len(rules) == 0 {
+		// The rule or its security group was deleted outside of Terraform.
+		d.SetId("")
+		return nil
+	}
+
+	rule := rules[0]
+	for k, v := range rule.fields() {
+		d.Set(k, v)
+	}
+	d.Set("security_group_id", rule.SecurityGroupID)
+	return nil
+}
+
+func resourceQingcloudSecurityGroupRuleDelete(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	groupID := d.Get("security_group_id").(string)
+	unlock := lockSecurityGroup(groupID)
+	defer unlock()
+
+	if err := deleteSecurityGroupRules(client, []string{d.Id()}); err != nil {
+		if isNotFound(err) {
+			d.SetId("")
+			return nil
+		}
+		return err
+	}
+	if err := applySecurityGroup(client, groupID, d.Timeout(schema.TimeoutDelete)); err != nil && !isNotFound(err) {
+		return err
+	}
+
+	d.SetId("")
+	return nil
+}
@@ -0,0 +1,112 @@
+package qingcloud
+
+import (
+	"fmt"
+	"testing"
+
+	r "github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestQingcloudSecurityGroupRule(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	groups := newFakeSecurityGroups(api)
+
+	config := func(httpPort string) string {
+		return api.providerConfig() + fmt.Sprintf(`
+resource "qingcloud_security_group" "web" {
+	name = "web"
+}
+
+resource "qingcloud_security_group_rule" "http" {
+	security_group_id = "${qingcloud_security_group.web.id}"
+	name              = "http"
+	protocol          = "tcp"
+	from_port         = %q
+	to_port           = %q
+}
+
+resource "qingcloud_security_group_rule" "egress" {
+	security_group_id = "${qingcloud_security_group.web.id}"
+	protocol          = "udp"
+	direction         = "egress"
+	action            = "drop"
+	priority          = 100
+	ip_network        = "0.0.0.0/0"
+}
+`, httpPort, httpPort)
+	}
+
+	var groupID, ruleID string
+	r.UnitTest(t, r.TestCase{
+		Providers:    testProviders(),
+		CheckDestroy: testQingcloudSecurityGroupsDestroyed(groups),
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: config("80"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_security_group_rule.http", "from_port", "80"),
+					r.TestCheckResourceAttr("qingcloud_security_group_rule.http", "direction", "ingress"),
+					r.TestCheckResourceAttr("qingcloud_security_group_rule.egress", "direction", "egress"),
+					r.TestCheckResourceAttr("qingcloud_security_group_rule.egress", "action", "drop"),
+					r.TestCheckResourceAttr("qingcloud_security_group_rule.egress", "priority", "100"),
+					r.TestCheckResourceAttrPair("qingcloud_security_group_rule.http", "security_group_id", "qingcloud_security_group.web", "id"),
+					testQingcloudInstanceID("qingcloud_security_group.web", &groupID),
+					testQingcloudInstanceID("qingcloud_security_group_rule.http", &ruleID),
+					testQingcloudSecurityGroupApplied(groups, &groupID),
+					testQingcloudRequests(api, "ApplySecurityGroup", 2),
+				),
+			},
+			r.TestStep{
+				// Standalone rules are left alone by the security group,
+				// which lists them as its rules.
+				Config: config("80"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_security_group.web", "rule.#", "2"),
+					testQingcloudRequests(api, "DeleteSecurityGroupRules", 0),
+				),
+			},
+			r.TestStep{
+				// Changing a rule replaces it.
+				Config: config("8080"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_security_group_rule.http", "from_port", "8080"),
+					testQingcloudSecurityGroupApplied(groups, &groupID),
+					testQingcloudRequests(api, "DeleteSecurityGroupRules", 1),
+					func(s *terraform.State) error {
+						if newID := s.RootModule().Resources["qingcloud_security_group_rule.http"].Primary.ID; newID == ruleID {
+							return fmt.Errorf("expected a new rule, got %s again", ruleID)
+						}
+						return nil
+					},
+					testQingcloudInstanceID("qingcloud_security_group_rule.http", &ruleID),
+				),
+			},
+			r.TestStep{
+				// A rule deleted outside of Terraform is added again.
+				PreConfig: func() {
+					groups.mu.Lock()
+					defer groups.mu.Unlock()
+					delete(groups.rules, ruleID)
+				},
+				Config: config("8080"),
+				Check: r.ComposeTestCheckFunc(
+					testQingcloudSecurityGroupApplied(groups, &groupID),
+					func(s *terraform.State) error {
+						if newID := s.RootModule().Resources["qingcloud_security_group_rule.http"].Primary.ID; newID == ruleID {
+							return fmt.Errorf("expected a new rule, got %s again", ruleID)
+						}
+						return nil
+					},
+				),
+			},
+			r.TestStep{
+				Config:            config("8080"),
+				ResourceName:      "qingcloud_security_group_rule.egress",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
@@ -0,0 +1,208 @@
+package qingcloud
+
+import (
+	"fmt"
+	"testing"
+
+	r "github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestQingcloudSecurityGroup(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	groups := newFakeSecurityGroups(api)
+
+	config := func(sshPort string) string {
+		return api.providerConfig() + fmt.Sprintf(`
+resource "qingcloud_security_group" "web" {
+	name        = "web"
+	description = "web servers"
+
+	rule {
+		name       = "ssh"
+		protocol   = "tcp"
+		from_port  = %q
+		to_port    = %q
+		ip_network = "10.0.0.0/8"
+	}
+
+	rule {
+		name      = "ping"
+		protocol  = "icmp"
+		priority  = 1
+		from_port = "8"
+		to_port   = "0"
+	}
+}
+`, sshPort, sshPort)
+	}
+
+	var id string
+	r.UnitTest(t, r.TestCase{
+		Providers:    testProviders(),
+		CheckDestroy: testQingcloudSecurityGroupsDestroyed(groups),
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: config("22"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_security_group.web", "name", "web"),
+					r.TestCheckResourceAttr("qingcloud_security_group.web", "description", "web servers"),
+					r.TestCheckResourceAttr("qingcloud_security_group.web", "rule.#", "2"),
+					testQingcloudInstanceID("qingcloud_security_group.web", &id),
+					testQingcloudSecurityGroupApplied(groups, &id),
+					testQingcloudRequests(api, "ApplySecurityGroup", 1),
+				),
+			},
+			r.TestStep{
+				// Only the changed rule is replaced.
+				Config: config("2222"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_security_group.web", "rule.#", "2"),
+					testQingcloudInstanceSameID("qingcloud_security_group.web", &id),
+					testQingcloudSecurityGroupApplied(groups, &id),
+					testQingcloudRequests(api, "ApplySecurityGroup", 2),
+					func(s *terraform.State) error {
+						del := api.requests("DeleteSecurityGroupRules")
+						if len(del) != 1 || len(fakeList(del[0], "security_group_rules")) != 1 {
+							return fmt.Errorf("unexpected DeleteSecurityGroupRules calls: %v", del)
+						}
+						add := api.requests("AddSecurityGroupRules")
+						if len(add) != 2 || add[1].Get("rules.1.val1") != "2222" || add[1].Get("rules.2.protocol") != "" {
+							return fmt.Errorf("unexpected AddSecurityGroupRules calls: %v", add)
+						}
+						return nil
+					},
+				),
+			},
+			r.TestStep{
+				// A rule added outside of Terraform is deleted.
+				PreConfig: func() {
+					groups.addRule(map[string]interface{}{
+						"security_group_rule_id": "sgr-drifted",
+						"security_group_id":      id,
+						"protocol":               "tcp",
+						"priority":               0,
+						"action":                 "accept",
+						"direction":              0,
+						"val1":                   "80",
+						"val2":                   "80",
+						"val3":                   "",
+					})
+				},
+				Config: config("2222"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_security_group.web", "rule.#", "2"),
+					testQingcloudSecurityGroupApplied(groups, &id),
+					func(s *terraform.State) error {
+						groups.mu.Lock()
+						defer groups.mu.Unlock()
+						if _, ok := groups.rules["sgr-drifted"]; ok {
+							return fmt.Errorf("expected sgr-drifted to be deleted")
+						}
+						return nil
+					},
+				),
+			},
+			r.TestStep{
+				Config:            config("2222"),
+				ResourceName:      "qingcloud_security_group.web",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+func TestQingcloudSecurityGroupRenameOnly(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	groups := newFakeSecurityGroups(api)
+
+	config := func(name string) string {
+		return api.providerConfig() + fmt.Sprintf(`
+resource "qingcloud_security_group" "db" {
+	name = %q
+
+	rule {
+		protocol  = "tcp"
+		from_port = "3306"
+		to_port   = "3306"
+	}
+}
+`, name)
+	}
+
+	r.UnitTest(t, r.TestCase{
+		Providers:    testProviders(),
+		CheckDestroy: testQingcloudSecurityGroupsDestroyed(groups),
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: config("db"),
+			},
+			r.TestStep{
+				// Renaming doesn't touch the rules.
+				Config: config("db-renamed"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_security_group.db", "name", "db-renamed"),
+					testQingcloudRequests(api, "AddSecurityGroupRules", 1),
+					testQingcloudRequests(api, "ApplySecurityGroup", 1),
+				),
+			},
+		},
+	})
+}
+
+func TestValidateRuleFields(t *testing.T) {
+	cases := []struct {
+		validate func(interface{}, string) ([]string, []error)
+		value    interface{}
+		valid    bool
+	}{
+		{validateRulePriority, 0, true},
+		{validateRulePriority, 100, true},
+		{validateRulePriority, 101, false},
+		{validateRulePriority, -1, false},
+		{validateRuleAction, "accept", true},
+		{validateRuleAction, "drop", true},
+		{validateRuleAction, "reject", false},
+		{validateRuleDirection, "ingress", true},
+		{validateRuleDirection, "egress", true},
+		{validateRuleDirection, "in", false},
+	}
+	for i, c := range cases {
+		if _, es := c.validate(c.value, "field"); (len(es) == 0) != c.valid {
+			t.Fatalf("%d: %v: expected valid to be %v, got errors %v", i, c.value, c.valid, es)
+		}
+	}
+}
+
+func testQingcloudSecurityGroupApplied(groups *fakeSecurityGroups, id *string) r.TestCheckFunc {
+	return func(s *terraform.State) error {
+		return groups.checkApplied(*id)
+	}
+}
+
+// testQingcloudRequests checks that action was called n times so far.
+func testQingcloudRequests(api *fakeAPI, action string, n int) r.TestCheckFunc {
+	return func(s *terraform.State) error {
+		if got := len(api.requests(action)); got != n {
+			return fmt.Errorf("expected %d %s calls, got %d", n, action, got)
+		}
+		return nil
+	}
+}
+
+func testQingcloudSecurityGroupsDestroyed(groups *fakeSecurityGroups) r.TestCheckFunc {
+	return func(s *terraform.State) error {
+		groups.mu.Lock()
+		defer groups.mu.Unlock()
+		for id := range groups.groups {
+			return fmt.Errorf("security group %s still exists", id)
+		}
+		for id := range groups.rules {
+			return fmt.Errorf("security group rule %s still exists", id)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,287 @@
+package qingcloud
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func resourceQingcloudVxnet() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceQingcloudVxnetCreate,
+		Read:   resourceQingcloudVxnetRead,
+		Update: resourceQingcloudVxnetUpdate,
+		Delete: resourceQingcloudVxnetDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+			Update: schema.DefaultTimeout(10 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"type": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      1,
+				ForceNew:     true,
+				Description:  "1 for a managed vxnet, 0 for an unmanaged one",
+				ValidateFunc: validateVxnetType,
+			},
+			"router_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "ID of the router the vxnet joins",
+			},
+			"ip_network": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "network of the vxnet in the router, such as 192.168.1.0/24",
+				ValidateFunc: validateIPNetwork,
+			},
+		},
+	}
+}
+
+type qingcloudVxnet struct {
+	VxNetID     string `json:"vxnet_id"`
+	VxNetName   string `json:"vxnet_name"`
+	VxNetType   int    `json:"vxnet_type"`
+	Description string `json:"description"`
+	Router      struct {
+		RouterID string `json:"router_id"`
+	} `json:"router"`
+}
+
+func resourceQingcloudVxnetCreate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	routerID := d.Get("router_id").(string)
+	ipNetwork := d.Get("ip_network").(string)
+	if (routerID == "") != (ipNetwork == "") {
+		return fmt.Errorf("router_id and ip_network must be set together")
+	}
+
+	params := url.Values{}
+	params.Set("vxnet_name", d.Get("name").(string))
+	params.Set("vxnet_type", strconv.Itoa(d.Get("type").(int)))
+	params.Set("count", "1")
+	var resp struct {
+		VxNets []string `json:"vxnets"`
+	}
+	if err := client.Do("CreateVxnets", params, &resp); err != nil {
+		return err
+	}
+	if len(resp.VxNets) == 0 {
+		return fmt.Errorf("CreateVxnets did not return a vxnet")
+	}
+	d.SetId(resp.VxNets[0])
+
+	if v, ok := d.GetOk("description"); ok {
+		if err := modifyVxnetAttributes(client, d.Id(), d.Get("name").(string), v.(string)); err != nil {
+			return err
+		}
+	}
+	if routerID != "" {
+		if err := joinRouter(client, d.Id(), routerID, ipNetwork, d.Timeout(schema.TimeoutCreate)); err != nil {
+			return err
+		}
+	}
+
+	return resourceQingcloudVxnetRead(d, meta)
+}
+
+func resourceQingcloudVxnetRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	vxnet, err := describeVxnet(client, d.Id())
+	if err != nil {
+		return err
+	}
+	if vxnet == nil {
+		d.SetId("")
+		return nil
+	}
+
+	ipNetwork := ""
+	if vxnet.Router.RouterID != "" {
+		ipNetwork, err = routerVxnetIPNetwork(client, vxnet.Router.RouterID, d.Id())
+		if err != nil {
+			return err
+		}
+	}
+
+	d.Set("name", vxnet.VxNetName)
+	d.Set("description", vxnet.Description)
+	d.Set("type", vxnet.VxNetType)
+	d.Set("router_id", vxnet.Router.RouterID)
+	d.Set("ip_network", ipNetwork)
+	return nil
+}
+
+func resourceQingcloudVxnetUpdate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	if d.HasChange("name") || d.HasChange("description") {
+		if err := modifyVxnetAttributes(client, d.Id(), d.Get("name").(string), d.Get("description").(string)); err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("router_id") || d.HasChange("ip_network") {
+		oldRouter, newRouter := d.GetChange("router_id")
+		ipNetwork := d.Get("ip_network").(string)
+		if (newRouter.(string) == "") != (ipNetwork == "") {
+			return fmt.Errorf("router_id and ip_network must be set together")
+		}
+
+		// A vxnet can only change of router or network by leaving it first.
+		if oldRouter.(string) != "" {
+			if err := leaveRouter(client, d.Id(), oldRouter.(string), d.Timeout(schema.TimeoutUpdate)); err != nil {
+				return err
+			}
+		}
+		if newRouter.(string) != "" {
+			if err := joinRouter(client, d.Id(), newRouter.(string), ipNetwork, d.Timeout(schema.TimeoutUpdate)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return resourceQingcloudVxnetRead(d, meta)
+}
+
+func resourceQingcloudVxnetDelete(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+
+	vxnet, err := describeVxnet(client, d.Id())
+	if err != nil {
+		return err
+	}
+	if vxnet == nil {
+		d.SetId("")
+		return nil
+	}
+	if vxnet.Router.RouterID != "" {
+		if err := leaveRouter(client, d.Id(), vxnet.Router.RouterID, d.Timeout(schema.TimeoutDelete)); err != nil {
+			return err
+		}
+	}
+
+	params := url.Values{}
+	setList(params, "vxnets", []string{d.Id()})
+	if err := client.Do("DeleteVxnets", params, nil); err != nil && !isNotFound(err) {
+		return err
+	}
+
+	d.SetId("")
+	return nil
+}
+
+// describeVxnet returns the vxnet with id, or nil if it doesn't exist
+// anymore.
+func describeVxnet(client *Client, id string) (*qingcloudVxnet, error) {
+	params := url.Values{}
+	setList(params, "vxnets", []string{id})
+	params.Set("verbose", "1")
+	var resp struct {
+		VxNetSet []*qingcloudVxnet `json:"vxnet_set"`
+	}
+	if err := client.Do("DescribeVxnets", params, &resp); err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(resp.VxNetSet) == 0 {
+		return nil, nil
+	}
+	return resp.VxNetSet[0], nil
+}
+
+func modifyVxnetAttributes(client *Client, id, name, description string) error {
+	params := url.Values{}
+	params.Set("vxnet", id)
+	params.Set("vxnet_name", name)
+	params.Set("description", description)
+	return client.Do("ModifyVxnetAttributes", params, nil)
+}
+
+func joinRouter(client *Client, vxnetID, routerID, ipNetwork string, timeout time.Duration) error {
+	params := url.Values{}
+	params.Set("vxnet", vxnetID)
+	params.Set("router", routerID)
+	params.Set("ip_network", ipNetwork)
+	return client.DoJob("JoinRouter", params, timeout)
+}
+
+func leaveRouter(client *Client, vxnetID, routerID string, timeout time.Duration) error {
+	params := url.Values{}
+	params.Set("router", routerID)
+	setList(params, "vxnets", []string{vxnetID})
+	return client.DoJob("LeaveRouter", params, timeout)
+}
+
+// routerVxnets returns the network of each vxnet joined to a router, only
+// looking for vxnetID if it isn't empty.
+func routerVxnets(client *Client, routerID, vxnetID string) (map[string]string, error) {
+	params := url.Values{}
+	params.Set("router", routerID)
+	if vxnetID != "" {
+		params.Set("vxnet", vxnetID)
+	}
+	var resp struct {
+		RouterVxNetSet []struct {
+			VxNetID   string `json:"vxnet_id"`
+			IPNetwork string `json:"ip_network"`
+		} `json:"router_vxnet_set"`
+	}
+	if err := client.Do("DescribeRouterVxnets", params, &resp); err != nil {
+		return nil, err
+	}
+
+	vxnets := make(map[string]string, len(resp.RouterVxNetSet))
+	for _, v := range resp.RouterVxNetSet {
+		vxnets[v.VxNetID] = v.IPNetwork
+	}
+	return vxnets, nil
+}
+
+func routerVxnetIPNetwork(client *Client, routerID, vxnetID string) (string, error) {
+	vxnets, err := routerVxnets(client, routerID, vxnetID)
+	if err != nil {
+		return "", err
+	}
+	return vxnets[vxnetID], nil
+}
+
+func validateVxnetType(v interface{}, key string) (ws []string, es []error) {
+	if t := v.(int); t != 0 && t != 1 {
+		es = append(es, fmt.Errorf("%s: must be 0 or 1, got %d", key, t))
+	}
+	return
+}
+
+func validateIPNetwork(v interface{}, key string) (ws []string, es []error) {
+	if s := v.(string); s != "" {
+		if _, _, err := net.ParseCIDR(s); err != nil {
+			es = append(es, fmt.Errorf("%s: must be a network in CIDR notation, got %q", key, s))
+		}
+	}
+	return
+}
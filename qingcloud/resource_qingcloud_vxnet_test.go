@@ -0,0 +1,178 @@
+package qingcloud
+
+import (
+	"fmt"
+	"testing"
+
+	r "github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestQingcloudVxnet(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	network := newFakeNetwork(api)
+
+	config := func(name, ipNetwork string) string {
+		return api.providerConfig() + fmt.Sprintf(`
+resource "qingcloud_router" "main" {
+	name = "main"
+}
+
+resource "qingcloud_vxnet" "web" {
+	name        = %q
+	description = "web servers"
+	router_id   = "${qingcloud_router.main.id}"
+	ip_network  = %q
+}
+`, name, ipNetwork)
+	}
+
+	var id string
+	r.UnitTest(t, r.TestCase{
+		Providers:    testProviders(),
+		CheckDestroy: testQingcloudNetworkDestroyed(network),
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: config("web", "192.168.1.0/24"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_vxnet.web", "name", "web"),
+					r.TestCheckResourceAttr("qingcloud_vxnet.web", "description", "web servers"),
+					r.TestCheckResourceAttr("qingcloud_vxnet.web", "type", "1"),
+					r.TestCheckResourceAttr("qingcloud_vxnet.web", "ip_network", "192.168.1.0/24"),
+					r.TestCheckResourceAttrPair("qingcloud_vxnet.web", "router_id", "qingcloud_router.main", "id"),
+					testQingcloudInstanceID("qingcloud_vxnet.web", &id),
+				),
+			},
+			r.TestStep{
+				// Changing the network leaves the router and joins it again.
+				Config: config("web-renamed", "192.168.2.0/24"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_vxnet.web", "name", "web-renamed"),
+					r.TestCheckResourceAttr("qingcloud_vxnet.web", "ip_network", "192.168.2.0/24"),
+					testQingcloudInstanceSameID("qingcloud_vxnet.web", &id),
+					func(s *terraform.State) error {
+						if n := len(api.requests("LeaveRouter")); n != 1 {
+							return fmt.Errorf("expected 1 LeaveRouter call, got %d", n)
+						}
+						joins := api.requests("JoinRouter")
+						if len(joins) != 2 || joins[1].Get("ip_network") != "192.168.2.0/24" {
+							return fmt.Errorf("unexpected JoinRouter calls: %v", joins)
+						}
+						return nil
+					},
+				),
+			},
+			r.TestStep{
+				// A vxnet that left its router outside of Terraform joins it
+				// again.
+				PreConfig: func() {
+					network.mu.Lock()
+					routerID := network.vxnets[id]["router"].(map[string]interface{})["router_id"].(string)
+					network.mu.Unlock()
+					if err := network.leave(id, routerID); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: config("web-renamed", "192.168.2.0/24"),
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_vxnet.web", "ip_network", "192.168.2.0/24"),
+					r.TestCheckResourceAttrPair("qingcloud_vxnet.web", "router_id", "qingcloud_router.main", "id"),
+					func(s *terraform.State) error {
+						network.mu.Lock()
+						defer network.mu.Unlock()
+						if _, ok := network.joined[id]; !ok {
+							return fmt.Errorf("expected vxnet %s to join the router again", id)
+						}
+						return nil
+					},
+				),
+			},
+			r.TestStep{
+				Config:            config("web-renamed", "192.168.2.0/24"),
+				ResourceName:      "qingcloud_vxnet.web",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			r.TestStep{
+				// A vxnet deleted outside of Terraform is recreated.
+				PreConfig: func() {
+					network.mu.Lock()
+					defer network.mu.Unlock()
+					delete(network.vxnets, id)
+					delete(network.joined, id)
+				},
+				Config: config("web-renamed", "192.168.2.0/24"),
+				Check: func(s *terraform.State) error {
+					if newID := s.RootModule().Resources["qingcloud_vxnet.web"].Primary.ID; newID == id {
+						return fmt.Errorf("expected a new vxnet, got %s again", id)
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+func TestQingcloudVxnetWithoutRouter(t *testing.T) {
+	api := newFakeAPI(t)
+	defer api.Close()
+	network := newFakeNetwork(api)
+
+	r.UnitTest(t, r.TestCase{
+		Providers:    testProviders(),
+		CheckDestroy: testQingcloudNetworkDestroyed(network),
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: api.providerConfig() + `
+resource "qingcloud_vxnet" "lab" {
+	type = 0
+}
+`,
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("qingcloud_vxnet.lab", "type", "0"),
+					r.TestCheckResourceAttr("qingcloud_vxnet.lab", "router_id", ""),
+					r.TestCheckResourceAttr("qingcloud_vxnet.lab", "ip_network", ""),
+					func(s *terraform.State) error {
+						if n := len(api.requests("JoinRouter")); n != 0 {
+							return fmt.Errorf("expected no JoinRouter call, got %d", n)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestValidateIPNetwork(t *testing.T) {
+	cases := map[string]bool{
+		"":               true,
+		"192.168.1.0/24": true,
+		"192.168.1.0":    false,
+		"192.168.1.0/33": false,
+	}
+	for v, valid := range cases {
+		if _, es := validateIPNetwork(v, "ip_network"); (len(es) == 0) != valid {
+			t.Fatalf("%q: expected valid to be %v, got errors %v", v, valid, es)
+		}
+	}
+}
+
+func testQingcloudNetworkDestroyed(network *fakeNetwork) r.TestCheckFunc {
+	return func(s *terraform.State) error {
+		network.mu.Lock()
+		defer network.mu.Unlock()
+		for id := range network.vxnets {
+			return fmt.Errorf("vxnet %s still exists", id)
+		}
+		for id, router := range network.routers {
+			switch router["status"] {
+			case routerStatusDeleted, routerStatusCeased:
+			default:
+				return fmt.Errorf("router %s is still %s", id, router["status"])
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,369 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+const cliUsage = `Usage: terraform-provider-qingcloud <command> [options] <args>
+
+Renders templates the way the template provider would, without Terraform.
+Diagnostics and sizes are written to stderr.
+
+Commands:
+    render            Render a template file to stdout
+    render-dir        Render a directory of templates like template_dir
+    render-cloudinit  Render a template_cloudinit_config to stdout
+
+Run "terraform-provider-qingcloud <command> -h" for the options of a command.
+`
+
+// RunCommand runs the command line interface of the provider binary with the
+// arguments following the binary name, and returns the exit status: 0 on
+// success, 1 if rendering failed and 2 on usage errors.
+func RunCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, cliUsage)
+		return 2
+	}
+
+	var run func([]string, io.Writer, io.Writer) error
+	switch args[0] {
+	case "render":
+		run = runRender
+	case "render-dir":
+		run = runRenderDir
+	case "render-cloudinit":
+		run = runRenderCloudinit
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, cliUsage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "Unknown command %q.\n\n%s", args[0], cliUsage)
+		return 2
+	}
+
+	if err := run(args[1:], stdout, stderr); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		if _, ok := err.(cliUsageError); ok {
+			if err.Error() != "" {
+				fmt.Fprintf(stderr, "%s\n", err)
+			}
+			return 2
+		}
+		fmt.Fprintf(stderr, "Error: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// cliUsageError is an error in the arguments of a command, as opposed to
+// an error rendering templates. It is empty if the flag package already
+// reported it.
+type cliUsageError string
+
+func (e cliUsageError) Error() string { return string(e) }
+
+// cliVarFlags are repeatable -var name=value flags.
+type cliVarFlags map[string]interface{}
+
+func (f cliVarFlags) String() string { return "" }
+
+func (f cliVarFlags) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("must be name=value, got %q", s)
+	}
+	f[s[:i]] = s[i+1:]
+	return nil
+}
+
+// cliFlags are the options shared by all commands.
+type cliFlags struct {
+	*flag.FlagSet
+	provider string
+	varsFile string
+	vars     cliVarFlags
+}
+
+func newCLIFlags(name, args string, stderr io.Writer, withVars bool) *cliFlags {
+	f := &cliFlags{
+		FlagSet: flag.NewFlagSet(name, flag.ContinueOnError),
+		vars:    cliVarFlags{},
+	}
+	f.SetOutput(stderr)
+	f.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: terraform-provider-qingcloud %s [options] %s\n\nOptions:\n", name, args)
+		f.PrintDefaults()
+	}
+	f.StringVar(&f.provider, "provider", "", "JSON `file` with the arguments of the provider block")
+	if withVars {
+		f.StringVar(&f.varsFile, "vars", "", "JSON `file` with an object of template variables")
+		f.Var(f.vars, "var", "template variable as `name=value`, can be repeated")
+	}
+	return f
+}
+
+// parse parses args and checks that n positional arguments remain.
+func (f *cliFlags) parse(args []string, n int) error {
+	if err := f.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return cliUsageError("")
+	}
+	if f.NArg() != n {
+		f.Usage()
+		return cliUsageError(fmt.Sprintf("%s: expected %d arguments, got %d", f.Name(), n, f.NArg()))
+	}
+	return nil
+}
+
+// providerConfig configures the provider from the -provider file, as the
+// provider block would.
+func (f *cliFlags) providerConfig(stderr io.Writer) (*providerConfig, error) {
+	raw := map[string]interface{}{}
+	if f.provider != "" {
+		if err := readCLIConfig(f.provider, &raw); err != nil {
+			return nil, err
+		}
+	}
+
+	p := Provider().(*schema.Provider)
+	c := cliResourceConfig(raw)
+	if err := cliDiagnostics("provider", stderr)(p.Validate(c)); err != nil {
+		return nil, err
+	}
+	if err := p.Configure(c); err != nil {
+		return nil, fmt.Errorf("provider: %s", err)
+	}
+	return providerConfigFromMeta(p.Meta()), nil
+}
+
+// templateVars returns the variables of the -vars file overridden by -var
+// flags.
+func (f *cliFlags) templateVars() (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	if f.varsFile != "" {
+		if err := readCLIConfig(f.varsFile, &vars); err != nil {
+			return nil, err
+		}
+		if _, es := validateVarsAttribute(vars, "vars"); len(es) > 0 {
+			return nil, fmt.Errorf("%s: %s", f.varsFile, es[0])
+		}
+	}
+	for k, v := range f.vars {
+		vars[k] = v
+	}
+	return vars, nil
+}
+
+func runRender(args []string, stdout, stderr io.Writer) error {
+	f := newCLIFlags("render", "<template>", stderr, true)
+	normalize := f.String("normalize", "none", "line ending `mode`: none, trim_trailing, lf or lf_trim")
+	if err := f.parse(args, 1); err != nil {
+		return err
+	}
+	filename := f.Arg(0)
+
+	if _, es := validateNormalize(*normalize, "normalize"); len(es) > 0 {
+		return cliUsageError(es[0].Error())
+	}
+	provider, err := f.providerConfig(stderr)
+	if err != nil {
+		return err
+	}
+	vars, err := f.templateVars()
+	if err != nil {
+		return err
+	}
+
+	// Unlike the filename of template_file, the argument is always a path.
+	if _, err := os.Stat(filename); err != nil {
+		return err
+	}
+	contents, err := provider.readFile(filename)
+	if err != nil {
+		return err
+	}
+
+	rendered, err := execute(normalizeText(contents, *normalize), vars, provider)
+	if err != nil {
+		return fmt.Errorf("failed to render %v: %v", filename, err)
+	}
+	rendered = normalizeText(rendered, *normalize)
+
+	fmt.Fprint(stdout, rendered)
+	fmt.Fprintf(stderr, "%s: %d bytes, rendered %d bytes\n", filename, len(contents), len(rendered))
+	return nil
+}
+
+func runRenderDir(args []string, stdout, stderr io.Writer) error {
+	f := newCLIFlags("render-dir", "<source_dir> <destination_dir>", stderr, true)
+	if err := f.parse(args, 2); err != nil {
+		return err
+	}
+	destinationDir := f.Arg(1)
+
+	provider, err := f.providerConfig(stderr)
+	if err != nil {
+		return err
+	}
+	vars, err := f.templateVars()
+	if err != nil {
+		return err
+	}
+	sourceDir, err := provider.resolvePath(f.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(destinationDir, 0777); err != nil {
+		return err
+	}
+	if err := renderDir(sourceDir, destinationDir, vars, provider); err != nil {
+		return err
+	}
+
+	// Report the files of the source directory, which are the ones rendered,
+	// rather than whatever else the destination directory contains.
+	var files int
+	var total int64
+	err = filepath.Walk(sourceDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, _ := filepath.Rel(sourceDir, p)
+		out, err := os.Stat(filepath.Join(destinationDir, relPath))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%s\n", filepath.Join(destinationDir, relPath))
+		fmt.Fprintf(stderr, "%s: %d bytes, rendered %d bytes\n", relPath, info.Size(), out.Size())
+		files++
+		total += out.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "rendered %d files, %d bytes\n", files, total)
+	return nil
+}
+
+func runRenderCloudinit(args []string, stdout, stderr io.Writer) error {
+	f := newCLIFlags("render-cloudinit", "<config.json>", stderr, false)
+	if err := f.parse(args, 1); err != nil {
+		return err
+	}
+
+	provider, err := f.providerConfig(stderr)
+	if err != nil {
+		return err
+	}
+	raw := map[string]interface{}{}
+	if err := readCLIConfig(f.Arg(0), &raw); err != nil {
+		return err
+	}
+
+	// Render through the schema of the data source, so that arguments are
+	// validated and defaulted as in a configuration.
+	var rendered string
+	var document []byte
+	r := dataSourceCloudinitConfig()
+	r.Read = func(d *schema.ResourceData, meta interface{}) error {
+		var err error
+		rendered, document, err = renderCloudinitConfig(d, providerConfigFromMeta(meta).forResource(d))
+		return err
+	}
+
+	c := cliResourceConfig(raw)
+	if err := cliDiagnostics(f.Arg(0), stderr)(r.Validate(c)); err != nil {
+		return err
+	}
+	diff, err := r.Diff(nil, c)
+	if err != nil {
+		return err
+	}
+	if _, err := r.ReadDataApply(diff, provider); err != nil {
+		return err
+	}
+
+	fmt.Fprint(stdout, rendered)
+	fmt.Fprintf(stderr, "%s: raw %d bytes, rendered %d bytes, sha256 %s\n", f.Arg(0), len(document), len(rendered), hash(rendered))
+	return nil
+}
+
+// readCLIConfig decodes the JSON file at path into v. Numbers and booleans
+// are decoded as strings, as Terraform interpolates them in configurations.
+func readCLIConfig(path string, v *map[string]interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	for k, value := range *v {
+		(*v)[k] = cliConfigValue(value)
+	}
+	return nil
+}
+
+func cliConfigValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = cliConfigValue(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = cliConfigValue(v[k])
+		}
+	}
+	return v
+}
+
+// cliResourceConfig returns raw as a configuration block without any
+// interpolation, so that templates don't need to escape theirs.
+func cliResourceConfig(raw map[string]interface{}) *terraform.ResourceConfig {
+	return &terraform.ResourceConfig{Raw: raw, Config: raw}
+}
+
+// cliDiagnostics returns a function printing the result of a validation to
+// stderr, and returning an error if it failed.
+func cliDiagnostics(prefix string, stderr io.Writer) func([]string, []error) error {
+	return func(ws []string, es []error) error {
+		for _, w := range ws {
+			fmt.Fprintf(stderr, "Warning: %s: %s\n", prefix, w)
+		}
+		if len(es) == 0 {
+			return nil
+		}
+		messages := make([]string, len(es))
+		for i, e := range es {
+			messages[i] = e.Error()
+		}
+		sort.Strings(messages)
+		return fmt.Errorf("%s: %s", prefix, strings.Join(messages, "; "))
+	}
+}
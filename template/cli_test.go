@@ -0,0 +1,163 @@
+package template
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testCLIDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "terraform_template_cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRunCommand(t *testing.T) {
+	dir := testCLIDir(t, map[string]string{
+		"hello.tpl":      "hello ${name} ${upper(env)} \r\n",
+		"blocked.tpl":    "${uuid()}",
+		"vars.json":      `{"name": "world", "count": 3}`,
+		"list.json":      `{"name": ["a"]}`,
+		"provider.json":  `{"vars": {"env": "prod"}, "deny_nondeterministic": true, "function": [{"name": "greet", "params": ["who"], "body": "\"hi ${who}\""}]}`,
+		"recursive.json": `{"function": [{"name": "loop", "body": "loop()"}]}`,
+		"cloudinit.json": `{"gzip": false, "base64_encode": false, "boundary": "B", "part": [` +
+			`{"content_type": "text/x-shellscript", "template": "echo ${greet(env)}"}]}`,
+		"gzip_level.json": `{"gzip_level": 42, "part": [{"content": "x"}]}`,
+	})
+	defer os.RemoveAll(dir)
+	in := func(name string) string { return filepath.Join(dir, name) }
+
+	cases := map[string]struct {
+		Args   []string
+		Status int
+		Stdout string
+		Stderr string
+	}{
+		"no command": {
+			Args:   []string{},
+			Status: 2,
+			Stderr: "Usage: terraform-provider-qingcloud <command>",
+		},
+		"unknown command": {
+			Args:   []string{"nope"},
+			Status: 2,
+			Stderr: `Unknown command "nope"`,
+		},
+		"render": {
+			Args:   []string{"render", "-vars", in("vars.json"), "-var", "env=dev", in("hello.tpl")},
+			Stdout: "hello world DEV \r\n",
+			Stderr: "hello.tpl: 30 bytes, rendered 18 bytes\n",
+		},
+		"render normalized": {
+			Args:   []string{"render", "-provider", in("provider.json"), "-var", "name=you", "-normalize", "lf_trim", in("hello.tpl")},
+			Stdout: "hello you PROD\n",
+		},
+		"render missing arguments": {
+			Args:   []string{"render"},
+			Status: 2,
+			Stderr: "render: expected 1 arguments, got 0",
+		},
+		"render bad normalize": {
+			Args:   []string{"render", "-normalize", "crlf", in("hello.tpl")},
+			Status: 2,
+			Stderr: "normalize: must be one of",
+		},
+		"render missing file": {
+			Args:   []string{"render", in("missing.tpl")},
+			Status: 1,
+			Stderr: "Error: stat ",
+		},
+		"render list variable": {
+			Args:   []string{"render", "-vars", in("list.json"), in("hello.tpl")},
+			Status: 1,
+			Stderr: "vars: cannot contain non-primitives; bad keys: name (list)",
+		},
+		"render blocked function": {
+			Args:   []string{"render", "-provider", in("provider.json"), in("blocked.tpl")},
+			Status: 1,
+			Stderr: `function "uuid" at 1:3 is nondeterministic`,
+		},
+		"render recursive provider function": {
+			Args:   []string{"render", "-provider", in("recursive.json"), in("blocked.tpl")},
+			Status: 1,
+			Stderr: `Error: provider: function "loop" is recursive: loop -> loop`,
+		},
+		"render-cloudinit": {
+			Args: []string{"render-cloudinit", "-provider", in("provider.json"), in("cloudinit.json")},
+			Stdout: "Content-Type: multipart/mixed; boundary=\"B\"\nMIME-Version: 1.0\r\n\r\n" +
+				"--B\r\nContent-Transfer-Encoding: 7bit\r\nContent-Type: text/x-shellscript\r\nMime-Version: 1.0\r\n\r\n" +
+				"echo hi prod\r\n--B--\r\n",
+			Stderr: "cloudinit.json: raw ",
+		},
+		"render-cloudinit invalid": {
+			Args:   []string{"render-cloudinit", in("gzip_level.json")},
+			Status: 1,
+			Stderr: "gzip_level: must be between 0 and 9",
+		},
+	}
+
+	for tn, tc := range cases {
+		var stdout, stderr bytes.Buffer
+		status := RunCommand(tc.Args, &stdout, &stderr)
+		if status != tc.Status {
+			t.Fatalf("%s: expected status %d, got %d: %s", tn, tc.Status, status, stderr.String())
+		}
+		if tc.Stdout != "" && stdout.String() != tc.Stdout {
+			t.Fatalf("%s: expected stdout %q, got %q", tn, tc.Stdout, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), tc.Stderr) {
+			t.Fatalf("%s: expected stderr to contain %q, got %q", tn, tc.Stderr, stderr.String())
+		}
+	}
+}
+
+func TestRunCommandRenderDir(t *testing.T) {
+	dir := testCLIDir(t, map[string]string{
+		"src/a.txt":        "${name}",
+		"src/nested/b.txt": "${upper(name)}!",
+	})
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	var stdout, stderr bytes.Buffer
+	status := RunCommand([]string{"render-dir", "-var", "name=x", filepath.Join(dir, "src"), out}, &stdout, &stderr)
+	if status != 0 {
+		t.Fatalf("expected status 0, got %d: %s", status, stderr.String())
+	}
+
+	for name, want := range map[string]string{"a.txt": "x", "nested/b.txt": "X!"} {
+		got, err := ioutil.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Fatalf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+	if want := filepath.Join(out, "a.txt") + "\n" + filepath.Join(out, "nested/b.txt") + "\n"; stdout.String() != want {
+		t.Fatalf("expected stdout %q, got %q", want, stdout.String())
+	}
+	if want := "rendered 2 files, 3 bytes\n"; !strings.HasSuffix(stderr.String(), want) {
+		t.Fatalf("expected stderr to end with %q, got %q", want, stderr.String())
+	}
+
+	stderr.Reset()
+	status = RunCommand([]string{"render-dir", filepath.Join(dir, "src"), out}, &stdout, &stderr)
+	if status != 1 || !strings.Contains(stderr.String(), "failed to render") {
+		t.Fatalf("expected a render error, got status %d: %s", status, stderr.String())
+	}
+}
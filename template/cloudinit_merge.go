@@ -0,0 +1,308 @@
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// defaultCloudConfigMergeType is the merge type cloud-init applies to a
+// cloud-config part that doesn't declare one.
+const defaultCloudConfigMergeType = "dict(replace)+list()+str()"
+
+var cloudConfigMergerPattern = regexp.MustCompile(`^([a-zA-Z_][A-Za-z0-9_]*)\((.*?)\)$`)
+
+// mergeCloudConfigParts merges all cloud-config parts into a single
+// cloud-config document the same way cloud-init does at boot. It returns an
+// empty string if there are no cloud-config parts.
+func mergeCloudConfigParts(parts cloudInitParts) (string, error) {
+	var merged interface{} = map[interface{}]interface{}{}
+	found := false
+
+	for i, part := range parts {
+		if !part.isCloudConfig() {
+			continue
+		}
+		found = true
+
+		var payload interface{}
+		if err := yaml.Unmarshal([]byte(part.Content), &payload); err != nil {
+			return "", fmt.Errorf("part %d: failed to parse cloud-config: %s", i, err)
+		}
+
+		merger, err := cloudConfigMergerFor(payload, part.MergeType)
+		if err != nil {
+			return "", fmt.Errorf("part %d: %s", i, err)
+		}
+		// Like cloud-init, drop the merge keys so they don't end up in the
+		// merged document.
+		if payload, ok := payload.(map[interface{}]interface{}); ok {
+			delete(payload, "merge_how")
+			delete(payload, "merge_type")
+		}
+		merged = merger.merge(merged, payload)
+	}
+
+	if !found {
+		return "", nil
+	}
+
+	out, err := yaml.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	return "#cloud-config\n" + string(out), nil
+}
+
+func (part cloudInitPart) isCloudConfig() bool {
+	switch part.ContentType {
+	case "text/cloud-config":
+		return true
+	case "", "text/plain":
+		// cloud-init guesses the type of text/plain parts from their content.
+		return detectCloudInitContentType(part.Content) == "text/cloud-config"
+	}
+	return false
+}
+
+// cloudConfigMerger holds the options of the dict, list and str mergers
+// selected by a merge type. A nil option set means the type isn't merged and
+// later values replace earlier ones.
+type cloudConfigMerger struct {
+	dict map[string]bool
+	list map[string]bool
+	str  map[string]bool
+}
+
+// cloudConfigMergerFor builds the merger for a part from the merge_how or
+// merge_type key of its payload and its X-Merge-Type header, falling back to
+// the cloud-init default if neither is set.
+func cloudConfigMergerFor(payload interface{}, header string) (*cloudConfigMerger, error) {
+	m := &cloudConfigMerger{}
+	found := false
+
+	if payload, ok := payload.(map[interface{}]interface{}); ok {
+		for _, key := range []string{"merge_how", "merge_type"} {
+			v, ok := payload[key]
+			if !ok {
+				continue
+			}
+			ok, err := m.addFromPayload(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", key, err)
+			}
+			found = found || ok
+			break
+		}
+	}
+
+	ok, err := m.addFromString(header)
+	if err != nil {
+		return nil, fmt.Errorf("invalid merge_type %q: %s", header, err)
+	}
+	found = found || ok
+
+	if !found {
+		if _, err := m.addFromString(defaultCloudConfigMergeType); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// addFromString adds the mergers of a merge type such as
+// "list(append)+dict(recurse_array)+str()".
+func (m *cloudConfigMerger) addFromString(s string) (bool, error) {
+	found := false
+	s = strings.Replace(strings.ToLower(s), "-", "_", -1)
+	for _, name := range strings.Split(s, "+") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		match := cloudConfigMergerPattern.FindStringSubmatch(name)
+		if match == nil {
+			return false, fmt.Errorf("bad merger %q", name)
+		}
+		var opts []string
+		for _, opt := range strings.Split(match[2], ",") {
+			if opt = strings.TrimSpace(opt); opt != "" {
+				opts = append(opts, opt)
+			}
+		}
+		if err := m.add(match[1], opts); err != nil {
+			return false, err
+		}
+		found = true
+	}
+	return found, nil
+}
+
+// addFromPayload adds the mergers of a merge_how key, which is either a
+// merge type string or a list of {name, settings} maps.
+func (m *cloudConfigMerger) addFromPayload(v interface{}) (bool, error) {
+	switch v := v.(type) {
+	case string:
+		return m.addFromString(v)
+	case []interface{}:
+		for _, raw := range v {
+			entry, ok := raw.(map[interface{}]interface{})
+			if !ok {
+				return false, fmt.Errorf("expected a map, got %T", raw)
+			}
+			name, _ := entry["name"].(string)
+			var opts []string
+			if settings, ok := entry["settings"].([]interface{}); ok {
+				for _, opt := range settings {
+					opts = append(opts, strings.ToLower(fmt.Sprint(opt)))
+				}
+			}
+			if err := m.add(strings.ToLower(name), opts); err != nil {
+				return false, err
+			}
+		}
+		return len(v) > 0, nil
+	}
+	return false, fmt.Errorf("expected a string or a list, got %T", v)
+}
+
+func (m *cloudConfigMerger) add(name string, opts []string) error {
+	set := map[string]bool{}
+	for _, opt := range opts {
+		set[opt] = true
+	}
+
+	// As in cloud-init, the first merger declared for a type wins.
+	switch name {
+	case "dict":
+		if m.dict == nil {
+			m.dict = set
+		}
+	case "list":
+		if m.list == nil {
+			m.list = set
+		}
+	case "str":
+		if m.str == nil {
+			m.str = set
+		}
+	default:
+		return fmt.Errorf("unknown merger %q", name)
+	}
+	return nil
+}
+
+func (m *cloudConfigMerger) merge(old, new interface{}) interface{} {
+	switch old := old.(type) {
+	case map[interface{}]interface{}:
+		if m.dict != nil {
+			return m.mergeDict(old, new)
+		}
+	case []interface{}:
+		if m.list != nil {
+			return m.mergeList(old, new)
+		}
+	case string:
+		if m.str != nil {
+			return m.mergeStr(old, new)
+		}
+	}
+	return new
+}
+
+func (m *cloudConfigMerger) mergeDict(old map[interface{}]interface{}, new interface{}) interface{} {
+	newMap, ok := new.(map[interface{}]interface{})
+	if !ok {
+		return old
+	}
+
+	replace := m.dict["replace"]
+	merged := make(map[interface{}]interface{}, len(old))
+	for k, v := range old {
+		merged[k] = v
+	}
+	for k, v := range newMap {
+		oldV, exists := merged[k]
+		switch {
+		case !exists:
+			merged[k] = v
+		case v == nil && m.dict["allow_delete"]:
+			delete(merged, k)
+		case replace:
+			merged[k] = v
+		default:
+			merged[k] = m.mergeNested(m.dict, oldV, v, true, true)
+		}
+	}
+	return merged
+}
+
+func (m *cloudConfigMerger) mergeList(old []interface{}, new interface{}) interface{} {
+	method := "replace"
+	for _, opt := range []string{"append", "prepend", "replace", "no_replace"} {
+		if m.list[opt] {
+			method = opt
+			break
+		}
+	}
+
+	// A value that isn't a list replaces the list, unless no_replace is set.
+	newList, ok := new.([]interface{})
+	if !ok {
+		if method == "no_replace" {
+			return old
+		}
+		return new
+	}
+
+	merged := make([]interface{}, 0, len(old)+len(newList))
+	switch method {
+	case "prepend":
+		return append(append(merged, newList...), old...)
+	case "append":
+		return append(append(merged, old...), newList...)
+	}
+
+	merged = append(merged, old...)
+	for i := 0; i < len(merged) && i < len(newList); i++ {
+		if method == "no_replace" {
+			break
+		}
+		merged[i] = m.mergeNested(m.list, merged[i], newList[i], m.list["recurse_dict"], false)
+	}
+	return merged
+}
+
+func (m *cloudConfigMerger) mergeStr(old string, new interface{}) interface{} {
+	newStr, ok := new.(string)
+	if !ok || !m.str["append"] {
+		return new
+	}
+	return old + newStr
+}
+
+// mergeNested merges two values found under the same key or index. Without
+// a matching recurse_* option, keepOld decides which of the two is kept: the
+// dict merger keeps the old value while the list merger takes the new one.
+func (m *cloudConfigMerger) mergeNested(opts map[string]bool, old, new interface{}, recurseDict, keepOld bool) interface{} {
+	switch new.(type) {
+	case []interface{}:
+		if opts["recurse_array"] || opts["recurse_list"] {
+			return m.merge(old, new)
+		}
+	case string:
+		if opts["recurse_str"] {
+			return m.merge(old, new)
+		}
+	case map[interface{}]interface{}:
+		if recurseDict {
+			return m.merge(old, new)
+		}
+	}
+	if keepOld {
+		return old
+	}
+	return new
+}
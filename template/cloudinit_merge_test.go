@@ -0,0 +1,133 @@
+package template
+
+import (
+	"strings"
+	"testing"
+
+	r "github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestMergeCloudConfigParts(t *testing.T) {
+	cases := map[string]struct {
+		Parts     cloudInitParts
+		Expected  string
+		ExpectErr string
+	}{
+		"no cloud-config parts": {
+			Parts: cloudInitParts{
+				{ContentType: "text/x-shellscript", Content: "#!/bin/sh\n"},
+			},
+			Expected: "",
+		},
+		"default merge replaces top-level keys": {
+			Parts: cloudInitParts{
+				{ContentType: "text/cloud-config", Content: "packages: [vim]\nusers: [alice]\n"},
+				{ContentType: "text/cloud-config", Content: "packages: [git]\n"},
+			},
+			Expected: "#cloud-config\npackages:\n- git\nusers:\n- alice\n",
+		},
+		"list append and dict recurse_array": {
+			Parts: cloudInitParts{
+				{ContentType: "text/cloud-config", Content: "packages: [vim]\nwrite_files:\n  a: [1]\n"},
+				{
+					ContentType: "text/cloud-config",
+					MergeType:   "list(append)+dict(recurse_array)+str()",
+					Content:     "packages: [git]\nwrite_files:\n  a: [2]\n  b: x\n",
+				},
+			},
+			Expected: "#cloud-config\npackages:\n- vim\n- git\nwrite_files:\n  a:\n  - 1\n  - 2\n  b: x\n",
+		},
+		"dict no_replace keeps existing scalars": {
+			Parts: cloudInitParts{
+				{ContentType: "text/cloud-config", Content: "hostname: a\n"},
+				{ContentType: "text/cloud-config", MergeType: "dict(no_replace)", Content: "hostname: b\nfqdn: b.example\n"},
+			},
+			Expected: "#cloud-config\nfqdn: b.example\nhostname: a\n",
+		},
+		"list append replaces the list with a scalar": {
+			Parts: cloudInitParts{
+				{ContentType: "text/cloud-config", Content: "packages: [vim]\n"},
+				{ContentType: "text/cloud-config", MergeType: "list(append)+dict(recurse_str)", Content: "packages: git\n"},
+			},
+			Expected: "#cloud-config\npackages: git\n",
+		},
+		"list no_replace keeps the list over a scalar": {
+			Parts: cloudInitParts{
+				{ContentType: "text/cloud-config", Content: "packages: [vim]\n"},
+				{ContentType: "text/cloud-config", MergeType: "list(no_replace)+dict(recurse_str)", Content: "packages: git\n"},
+			},
+			Expected: "#cloud-config\npackages:\n- vim\n",
+		},
+		"merge_how in payload": {
+			Parts: cloudInitParts{
+				{ContentType: "text/cloud-config", Content: "runcmd: [a]\n"},
+				{ContentType: "text/cloud-config", Content: "merge_how: list(prepend)+dict(recurse_list)\nruncmd: [b]\n"},
+			},
+			Expected: "#cloud-config\nruncmd:\n- b\n- a\n",
+		},
+		"text/plain parts are detected": {
+			Parts: cloudInitParts{
+				{Content: "#cloud-config\nhostname: a\n"},
+			},
+			Expected: "#cloud-config\nhostname: a\n",
+		},
+		"invalid merge type": {
+			Parts: cloudInitParts{
+				{ContentType: "text/cloud-config", MergeType: "tuple(append)", Content: "a: b\n"},
+			},
+			ExpectErr: `part 0: invalid merge_type "tuple(append)": unknown merger "tuple"`,
+		},
+		"invalid yaml": {
+			Parts: cloudInitParts{
+				{ContentType: "text/cloud-config", Content: "a: [b\n"},
+			},
+			ExpectErr: "part 0: failed to parse cloud-config",
+		},
+	}
+
+	for tn, tc := range cases {
+		merged, err := mergeCloudConfigParts(tc.Parts)
+		if err != nil {
+			if tc.ExpectErr == "" {
+				t.Fatalf("%s: expected no err, got: %s", tn, err)
+			}
+			if !strings.Contains(err.Error(), tc.ExpectErr) {
+				t.Fatalf("%s: expected\n%s\nto contain\n%s", tn, err, tc.ExpectErr)
+			}
+			continue
+		}
+		if tc.ExpectErr != "" {
+			t.Fatalf("%s: expected err containing %q, got none!", tn, tc.ExpectErr)
+		}
+		if merged != tc.Expected {
+			t.Fatalf("%s: expected\n%s\ngot\n%s", tn, tc.Expected, merged)
+		}
+	}
+}
+
+func TestRender_mergedCloudConfig(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					part {
+						content_type = "text/cloud-config"
+						content      = "packages: [vim]\n"
+					}
+					part {
+						content_type = "text/cloud-config"
+						merge_type   = "list(append)+dict(recurse_array)+str()"
+						content      = "packages: [git]\n"
+					}
+					part {
+						content_type = "text/x-shellscript"
+						content      = "#!/bin/sh\n"
+					}
+				}`,
+				Check: r.TestCheckResourceAttr("data.template_cloudinit_config.foo", "merged_cloud_config",
+					"#cloud-config\npackages:\n- vim\n- git\n"),
+			},
+		},
+	})
+}
@@ -3,14 +3,19 @@ package template
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"mime/quotedprintable"
 	"net/textproto"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
-	"github.com/hashicorp/terraform/helper/hashcode"
 	"github.com/hashicorp/terraform/helper/schema"
 )
 
@@ -18,6 +23,9 @@ func dataSourceCloudinitConfig() *schema.Resource {
 	return &schema.Resource{
 		Read: dataSourceCloudinitConfigRead,
 
+		SchemaVersion: 1,
+		MigrateState:  resourceCloudinitConfigMigrateState,
+
 		Schema: map[string]*schema.Schema{
 			"part": {
 				Type:     schema.TypeList,
@@ -30,7 +38,30 @@ func dataSourceCloudinitConfig() *schema.Resource {
 						},
 						"content": {
 							Type:     schema.TypeString,
-							Required: true,
+							Optional: true,
+						},
+						"content_base64": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"template": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"vars": {
+							Type:         schema.TypeMap,
+							Optional:     true,
+							ValidateFunc: validateVarsAttribute,
+						},
+						"headers": {
+							Type:         schema.TypeMap,
+							Optional:     true,
+							ValidateFunc: validatePartHeaders,
+						},
+						"encoding": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateTransferEncoding,
 						},
 						"filename": {
 							Type:     schema.TypeString,
@@ -48,45 +79,260 @@ func dataSourceCloudinitConfig() *schema.Resource {
 				Optional: true,
 				Default:  true,
 			},
+			"gzip_level": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      gzip.DefaultCompression,
+				ValidateFunc: validateGzipLevel,
+			},
 			"base64_encode": {
 				Type:     schema.TypeBool,
 				Optional: true,
 				Default:  true,
 			},
+			"boundary": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"output_format": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "mime",
+				ValidateFunc: validateOutputFormat,
+			},
+			"instances": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Description:  "number of instances to render user data for",
+				ValidateFunc: validateNonNegative,
+			},
+			"instance_vars": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "variables for each instance's part templates",
+				Elem:        &schema.Schema{Type: schema.TypeMap},
+			},
+			"max_size": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Description:  "maximum size in bytes of the rendered output",
+				ValidateFunc: validateNonNegative,
+			},
 			"rendered": {
 				Type:        schema.TypeString,
 				Computed:    true,
 				Description: "rendered cloudinit configuration",
 			},
+			"rendered_list": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "rendered cloudinit configuration of each instance",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"rendered_sha256": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "sha256 of the rendered cloudinit configuration",
+			},
+			"raw_sha256": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "sha256 of the cloudinit configuration before gzip and base64 encoding",
+			},
+			"allowed_functions": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "interpolation functions part templates may call, all if unset",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"deny_nondeterministic": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+				Description: "whether to deny functions such as timestamp() and uuid() " +
+					"in part templates",
+			},
+			"merged_cloud_config": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "cloud-config parts merged as cloud-init would",
+			},
 		},
 	}
 }
 
 func dataSourceCloudinitConfigRead(d *schema.ResourceData, meta interface{}) error {
-	rendered, err := renderCloudinitConfig(d)
+	provider := providerConfigFromMeta(meta).forResource(d)
+	instances := d.Get("instances").(int)
+	if instances == 0 {
+		parts, err := readCloudInitParts(d, nil, provider)
+		if err != nil {
+			return err
+		}
+		rendered, raw, err := renderCloudinitParts(d, parts)
+		if err != nil {
+			return err
+		}
+		merged, err := mergeCloudConfigParts(parts)
+		if err != nil {
+			return err
+		}
+
+		d.Set("rendered", rendered)
+		d.Set("rendered_list", []string{})
+		d.Set("merged_cloud_config", merged)
+		d.Set("rendered_sha256", hash(rendered))
+		d.Set("raw_sha256", hash(string(raw)))
+		d.SetId(hash(rendered))
+		return nil
+	}
+
+	instanceVars := d.Get("instance_vars").([]interface{})
+	if len(instanceVars) > instances {
+		return fmt.Errorf("instance_vars has %d elements, but there are only %d instances", len(instanceVars), instances)
+	}
+
+	renderedList := make([]string, instances)
+	var first cloudInitParts
+	var firstRaw []byte
+	for i := 0; i < instances; i++ {
+		vars := map[string]interface{}{}
+		if i < len(instanceVars) {
+			if m, ok := instanceVars[i].(map[string]interface{}); ok {
+				for k, v := range m {
+					vars[k] = v
+				}
+			}
+		}
+		for _, k := range []string{"instance_index", "instance_count"} {
+			if _, ok := vars[k]; ok {
+				return fmt.Errorf("instance_vars.%d: %q is reserved", i, k)
+			}
+		}
+		vars["instance_index"] = strconv.Itoa(i)
+		vars["instance_count"] = strconv.Itoa(instances)
+
+		parts, err := readCloudInitParts(d, vars, provider)
+		if err != nil {
+			return fmt.Errorf("instance %d: %s", i, err)
+		}
+		rendered, raw, err := renderCloudinitParts(d, parts)
+		if err != nil {
+			return fmt.Errorf("instance %d: %s", i, err)
+		}
+		renderedList[i] = rendered
+		if i == 0 {
+			first, firstRaw = parts, raw
+		}
+	}
+
+	merged, err := mergeCloudConfigParts(first)
 	if err != nil {
 		return err
 	}
 
-	d.Set("rendered", rendered)
-	d.SetId(strconv.Itoa(hashcode.String(rendered)))
+	d.Set("rendered", renderedList[0])
+	d.Set("rendered_list", renderedList)
+	d.Set("merged_cloud_config", merged)
+	d.Set("rendered_sha256", hash(renderedList[0]))
+	d.Set("raw_sha256", hash(string(firstRaw)))
+	d.SetId(hash(strings.Join(renderedList, "\n")))
 	return nil
 }
 
-func renderCloudinitConfig(d *schema.ResourceData) (string, error) {
+// renderCloudinitConfig returns the rendered cloudinit config along with the
+// raw document it was rendered from, before gzip and base64 encoding.
+func renderCloudinitConfig(d *schema.ResourceData, provider *providerConfig) (string, []byte, error) {
+	cloudInitParts, err := readCloudInitParts(d, nil, provider)
+	if err != nil {
+		return "", nil, err
+	}
+	return renderCloudinitParts(d, cloudInitParts)
+}
+
+// renderCloudinitParts renders parts using the output settings of d.
+func renderCloudinitParts(d *schema.ResourceData, cloudInitParts cloudInitParts) (string, []byte, error) {
 	gzipOutput := d.Get("gzip").(bool)
 	base64Output := d.Get("base64_encode").(bool)
 
+	var raw []byte
+	var err error
+	if d.Get("output_format").(string) == "windows" {
+		raw, err = renderWindowsUserData(cloudInitParts)
+		if err != nil {
+			return "", nil, err
+		}
+	} else {
+		boundary, err := selectBoundary(cloudInitParts, d.Get("boundary").(string))
+		if err != nil {
+			return "", nil, err
+		}
+
+		var buffer bytes.Buffer
+		if err := renderPartsToWriter(cloudInitParts, boundary, &buffer); err != nil {
+			return "", nil, err
+		}
+		raw = buffer.Bytes()
+	}
+
+	data := raw
+	if gzipOutput {
+		data, err = gzipBytes(raw, d.Get("gzip_level").(int))
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	output := ""
+	if base64Output {
+		output = base64.StdEncoding.EncodeToString(data)
+	} else {
+		output = string(data)
+	}
+
+	if err := checkRenderedSize(d.Get("max_size").(int), raw, output, d.Get("gzip_level").(int)); err != nil {
+		return "", nil, err
+	}
+
+	return output, raw, nil
+}
+
+// gzipBytes compresses data with a pinned gzip header, so that the output
+// only depends on data and level.
+func gzipBytes(data []byte, level int) ([]byte, error) {
+	var buffer bytes.Buffer
+	gzipWriter, err := gzip.NewWriterLevel(&buffer, level)
+	if err != nil {
+		return nil, err
+	}
+	gzipWriter.Header = gzip.Header{
+		Name:    "",
+		ModTime: time.Time{},
+		OS:      gzipOSUnknown,
+	}
+	if _, err := gzipWriter.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// readCloudInitParts reads the part blocks of a cloudinit config. Part
+// templates are rendered with extraVars on top of their own vars, merged
+// with the provider variables.
+func readCloudInitParts(d *schema.ResourceData, extraVars map[string]interface{}, provider *providerConfig) (cloudInitParts, error) {
 	partsValue, hasParts := d.GetOk("part")
 	if !hasParts {
-		return "", fmt.Errorf("No parts found in the cloudinit resource declaration")
+		return nil, fmt.Errorf("No parts found in the cloudinit resource declaration")
 	}
 
 	cloudInitParts := make(cloudInitParts, len(partsValue.([]interface{})))
 	for i, v := range partsValue.([]interface{}) {
 		p, castOk := v.(map[string]interface{})
 		if !castOk {
-			return "", fmt.Errorf("Unable to parse parts in cloudinit resource declaration")
+			return nil, fmt.Errorf("Unable to parse parts in cloudinit resource declaration")
 		}
 
 		part := cloudInitPart{}
@@ -96,53 +342,90 @@ func renderCloudinitConfig(d *schema.ResourceData) (string, error) {
 		if p, ok := p["content"]; ok {
 			part.Content = p.(string)
 		}
+		if p, ok := p["content_base64"]; ok && p.(string) != "" {
+			if part.Content != "" {
+				return nil, fmt.Errorf("part %d: only one of content or content_base64 may be set", i)
+			}
+			decoded, err := base64.StdEncoding.DecodeString(p.(string))
+			if err != nil {
+				return nil, fmt.Errorf("part %d: failed to decode content_base64: %s", i, err)
+			}
+			part.Content = string(decoded)
+		}
+		if t, ok := p["template"]; ok && t.(string) != "" {
+			if part.Content != "" {
+				return nil, fmt.Errorf("part %d: only one of content, content_base64 or template may be set", i)
+			}
+			vars := map[string]interface{}{}
+			if partVars, ok := p["vars"].(map[string]interface{}); ok {
+				for k, v := range partVars {
+					vars[k] = v
+				}
+			}
+			for k, v := range extraVars {
+				vars[k] = v
+			}
+			rendered, err := execute(t.(string), vars, provider)
+			if err != nil {
+				return nil, templateRenderError(
+					fmt.Errorf("part %d: failed to render template: %v", i, err),
+				)
+			}
+			part.Content = rendered
+		}
+		if !partHasBody(p) {
+			return nil, fmt.Errorf("part %d: one of content, content_base64 or template must be set", i)
+		}
+		if p, ok := p["encoding"]; ok {
+			part.Encoding = p.(string)
+		}
 		if p, ok := p["merge_type"]; ok {
 			part.MergeType = p.(string)
 		}
 		if p, ok := p["filename"]; ok {
 			part.Filename = p.(string)
 		}
+		if p, ok := p["headers"].(map[string]interface{}); ok && len(p) > 0 {
+			part.Headers = make(map[string]string, len(p))
+			for k, v := range p {
+				part.Headers[k] = fmt.Sprint(v)
+			}
+		}
+
+		part, err := normalizeWindowsPart(part)
+		if err != nil {
+			return nil, fmt.Errorf("part %d: %s", i, err)
+		}
 		cloudInitParts[i] = part
 	}
 
-	var buffer bytes.Buffer
-
-	var err error
-	if gzipOutput {
-		gzipWriter := gzip.NewWriter(&buffer)
-		err = renderPartsToWriter(cloudInitParts, gzipWriter)
-		gzipWriter.Close()
-	} else {
-		err = renderPartsToWriter(cloudInitParts, &buffer)
-	}
-	if err != nil {
-		return "", err
-	}
+	return cloudInitParts, nil
+}
 
-	output := ""
-	if base64Output {
-		output = base64.StdEncoding.EncodeToString(buffer.Bytes())
-	} else {
-		output = buffer.String()
+// partHasBody reports whether a part block sets any of its body fields.
+func partHasBody(p map[string]interface{}) bool {
+	for _, k := range []string{"content", "content_base64", "template"} {
+		if v, ok := p[k].(string); ok && v != "" {
+			return true
+		}
 	}
-
-	return output, nil
+	return false
 }
 
-func renderPartsToWriter(parts cloudInitParts, writer io.Writer) error {
+func renderPartsToWriter(parts cloudInitParts, boundary string, writer io.Writer) error {
 	mimeWriter := multipart.NewWriter(writer)
 	defer mimeWriter.Close()
 
 	// we need to set the boundary explictly, otherwise the boundary is random
 	// and this causes terraform to complain about the resource being different
-	if err := mimeWriter.SetBoundary("MIMEBOUNDARY"); err != nil {
-		return err
+	if err := mimeWriter.SetBoundary(boundary); err != nil {
+		return fmt.Errorf("invalid boundary %q: %s", boundary, err)
 	}
 
 	writer.Write([]byte(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\n", mimeWriter.Boundary())))
 	writer.Write([]byte("MIME-Version: 1.0\r\n\r\n"))
 
-	for _, part := range parts {
+	for i, part := range parts {
 		header := textproto.MIMEHeader{}
 		if part.ContentType == "" {
 			header.Set("Content-Type", "text/plain")
@@ -150,8 +433,17 @@ func renderPartsToWriter(parts cloudInitParts, writer io.Writer) error {
 			header.Set("Content-Type", part.ContentType)
 		}
 
+		encoding := part.Encoding
+		if encoding == "" {
+			encoding = detectTransferEncoding(part.Content)
+		} else if encoding == "7bit" && detectTransferEncoding(part.Content) != "7bit" {
+			return fmt.Errorf("part %d: content is not 7-bit clean, use a different encoding", i)
+		} else if encoding == "8bit" && detectTransferEncoding(part.Content) == "base64" {
+			return fmt.Errorf("part %d: content is binary or has lines over 998 octets, use base64 or quoted-printable", i)
+		}
+
 		header.Set("MIME-Version", "1.0")
-		header.Set("Content-Transfer-Encoding", "7bit")
+		header.Set("Content-Transfer-Encoding", encoding)
 
 		if part.Filename != "" {
 			header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, part.Filename))
@@ -161,12 +453,19 @@ func renderPartsToWriter(parts cloudInitParts, writer io.Writer) error {
 			header.Set("X-Merge-Type", part.MergeType)
 		}
 
+		for k, v := range part.Headers {
+			if renderedPartHeaders[textproto.CanonicalMIMEHeaderKey(k)] {
+				return fmt.Errorf("part %d: header %q is set by the renderer and cannot be overridden", i, k)
+			}
+			header.Set(k, v)
+		}
+
 		partWriter, err := mimeWriter.CreatePart(header)
 		if err != nil {
 			return err
 		}
 
-		_, err = partWriter.Write([]byte(part.Content))
+		err = writeEncodedContent(partWriter, encoding, part.Content)
 		if err != nil {
 			return err
 		}
@@ -175,11 +474,155 @@ func renderPartsToWriter(parts cloudInitParts, writer io.Writer) error {
 	return nil
 }
 
+const defaultBoundary = "MIMEBOUNDARY"
+
+// gzipOSUnknown is the OS byte written to gzip headers. Go writes it by
+// default too, but it is pinned here as it is part of the rendered output.
+const gzipOSUnknown = 255
+
+func validateGzipLevel(v interface{}, key string) (ws []string, es []error) {
+	level := v.(int)
+	if level != gzip.DefaultCompression && (level < gzip.NoCompression || level > gzip.BestCompression) {
+		es = append(es, fmt.Errorf(
+			"%s: must be between %d and %d, or %d for the default level, got %d",
+			key, gzip.NoCompression, gzip.BestCompression, gzip.DefaultCompression, level))
+	}
+	return
+}
+
+// selectBoundary returns the MIME boundary to render parts with. A requested
+// boundary is used as-is but must not occur in any part. Otherwise the
+// historical default is kept unless a part contains it, in which case a
+// boundary is derived from a hash of all part contents so that the output
+// stays deterministic.
+func selectBoundary(parts cloudInitParts, requested string) (string, error) {
+	if requested != "" {
+		if i := parts.indexContaining(requested); i != -1 {
+			return "", fmt.Errorf("part %d: content contains the boundary %q", i, requested)
+		}
+		return requested, nil
+	}
+
+	if parts.indexContaining(defaultBoundary) == -1 {
+		return defaultBoundary, nil
+	}
+
+	sha := sha256.New()
+	for _, part := range parts {
+		fmt.Fprintf(sha, "%d:%s", len(part.Content), part.Content)
+	}
+	sum := sha.Sum(nil)
+	for {
+		boundary := fmt.Sprintf("%s-%x", defaultBoundary, sum[:16])
+		if parts.indexContaining(boundary) == -1 {
+			return boundary, nil
+		}
+		next := sha256.Sum256(sum)
+		sum = next[:]
+	}
+}
+
+// renderedPartHeaders are the part headers renderPartsToWriter sets itself,
+// in canonical form.
+var renderedPartHeaders = map[string]bool{
+	"Content-Type":              true,
+	"Mime-Version":              true,
+	"Content-Transfer-Encoding": true,
+	"Content-Disposition":       true,
+	"X-Merge-Type":              true,
+}
+
+var partHeaderNamePattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+func validatePartHeaders(v interface{}, key string) (ws []string, es []error) {
+	for k, value := range v.(map[string]interface{}) {
+		switch {
+		case !partHeaderNamePattern.MatchString(k):
+			es = append(es, fmt.Errorf("%s: invalid header name %q", key, k))
+		case renderedPartHeaders[textproto.CanonicalMIMEHeaderKey(k)]:
+			es = append(es, fmt.Errorf(
+				"%s: header %q is set by the renderer, use the corresponding part argument instead", key, k))
+		case strings.ContainsAny(fmt.Sprint(value), "\r\n"):
+			es = append(es, fmt.Errorf("%s: value of header %q cannot contain line breaks", key, k))
+		}
+	}
+	return
+}
+
+// detectTransferEncoding picks the least invasive transfer encoding that can
+// carry content safely: 7bit for plain ASCII, 8bit for UTF-8 text and base64
+// for anything else.
+func detectTransferEncoding(content string) string {
+	if strings.IndexByte(content, 0) != -1 || !utf8.ValidString(content) {
+		return "base64"
+	}
+	for _, line := range strings.Split(content, "\n") {
+		// RFC 5322 limits lines to 998 octets excluding the CRLF.
+		if len(strings.TrimSuffix(line, "\r")) > 998 {
+			return "base64"
+		}
+	}
+	for i := 0; i < len(content); i++ {
+		if content[i] >= utf8.RuneSelf {
+			return "8bit"
+		}
+	}
+	return "7bit"
+}
+
+func writeEncodedContent(writer io.Writer, encoding, content string) error {
+	switch encoding {
+	case "base64":
+		encoded := base64.StdEncoding.EncodeToString([]byte(content))
+		for len(encoded) > 76 {
+			if _, err := io.WriteString(writer, encoded[:76]+"\r\n"); err != nil {
+				return err
+			}
+			encoded = encoded[76:]
+		}
+		_, err := io.WriteString(writer, encoded)
+		return err
+	case "quoted-printable":
+		qpWriter := quotedprintable.NewWriter(writer)
+		if _, err := io.WriteString(qpWriter, content); err != nil {
+			return err
+		}
+		return qpWriter.Close()
+	default:
+		_, err := io.WriteString(writer, content)
+		return err
+	}
+}
+
+func validateTransferEncoding(v interface{}, key string) (ws []string, es []error) {
+	switch v.(string) {
+	case "", "7bit", "8bit", "base64", "quoted-printable":
+	default:
+		es = append(es, fmt.Errorf(
+			"%s: must be one of 7bit, 8bit, base64 or quoted-printable, got %q",
+			key, v.(string)))
+	}
+	return
+}
+
 type cloudInitPart struct {
 	ContentType string
 	MergeType   string
 	Filename    string
+	Encoding    string
+	Headers     map[string]string
 	Content     string
 }
 
 type cloudInitParts []cloudInitPart
+
+// indexContaining returns the index of the first part whose content contains
+// the given boundary delimiter, or -1 if there is none.
+func (parts cloudInitParts) indexContaining(boundary string) int {
+	for i, part := range parts {
+		if strings.Contains(part.Content, "--"+boundary) {
+			return i
+		}
+	}
+	return -1
+}
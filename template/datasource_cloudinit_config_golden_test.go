@@ -0,0 +1,59 @@
+package template
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+// TestRenderCloudinitConfig_gzipGolden locks the exact gzipped bytes, so that
+// a change in compress/gzip or in the rendering shows up as a failing test
+// instead of as a diff on every instance's user_data.
+func TestRenderCloudinitConfig_gzipGolden(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"cloudinit_config_gzip_default.golden": {},
+		"cloudinit_config_gzip_level1.golden":  {"gzip_level": 1},
+		"cloudinit_config_gzip_level9.golden":  {"gzip_level": 9},
+	}
+
+	for golden, raw := range cases {
+		raw["base64_encode"] = false
+		raw["part"] = []interface{}{
+			map[string]interface{}{
+				"content_type": "text/cloud-config",
+				"content":      "#cloud-config\npackages:\n  - vim\n  - git\n",
+			},
+			map[string]interface{}{
+				"content_type": "text/x-shellscript",
+				"content":      "#!/bin/sh\necho hello world\necho hello world\n",
+			},
+		}
+
+		d := schema.TestResourceDataRaw(t, dataSourceCloudinitConfig().Schema, raw)
+		rendered, _, err := renderCloudinitConfig(d, nil)
+		if err != nil {
+			t.Fatalf("%s: err: %s", golden, err)
+		}
+
+		path := filepath.Join("testdata", golden)
+		if *updateGolden {
+			if err := ioutil.WriteFile(path, []byte(rendered), 0644); err != nil {
+				t.Fatalf("%s: err: %s", golden, err)
+			}
+		}
+
+		expected, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s: err: %s", golden, err)
+		}
+		if !bytes.Equal([]byte(rendered), expected) {
+			t.Fatalf("%s: rendered output doesn't match golden file\n got: %x\nwant: %x", golden, rendered, expected)
+		}
+	}
+}
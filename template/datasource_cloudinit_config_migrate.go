@@ -0,0 +1,62 @@
+package template
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func resourceCloudinitConfigMigrateState(
+	v int, is *terraform.InstanceState, meta interface{}) (*terraform.InstanceState, error) {
+	switch v {
+	case 0:
+		log.Println("[INFO] Found template_cloudinit_config State v0; migrating to v1")
+		return migrateCloudinitConfigStateV0toV1(is)
+	default:
+		return is, fmt.Errorf("Unexpected schema version: %d", v)
+	}
+}
+
+// migrateCloudinitConfigStateV0toV1 replaces the crc32 based ID with the
+// sha256 of the rendered output and fills in the new hash attributes.
+func migrateCloudinitConfigStateV0toV1(is *terraform.InstanceState) (*terraform.InstanceState, error) {
+	if is.Empty() || is.Attributes == nil {
+		log.Println("[DEBUG] Empty InstanceState; nothing to migrate.")
+		return is, nil
+	}
+
+	log.Printf("[DEBUG] Attributes before migration: %#v", is.Attributes)
+
+	rendered := is.Attributes["rendered"]
+	raw := []byte(rendered)
+	if is.Attributes["base64_encode"] == "true" {
+		decoded, err := base64.StdEncoding.DecodeString(string(raw))
+		if err != nil {
+			return is, fmt.Errorf("failed to decode rendered output: %s", err)
+		}
+		raw = decoded
+	}
+	if is.Attributes["gzip"] == "true" {
+		gzipReader, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return is, fmt.Errorf("failed to decompress rendered output: %s", err)
+		}
+		raw, err = ioutil.ReadAll(gzipReader)
+		if err != nil {
+			return is, fmt.Errorf("failed to decompress rendered output: %s", err)
+		}
+	}
+
+	is.ID = hash(rendered)
+	is.Attributes["id"] = is.ID
+	is.Attributes["rendered_sha256"] = hash(rendered)
+	is.Attributes["raw_sha256"] = hash(string(raw))
+
+	log.Printf("[DEBUG] Attributes after migration: %#v", is.Attributes)
+	return is, nil
+}
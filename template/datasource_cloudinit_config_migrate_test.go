@@ -0,0 +1,67 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestCloudinitConfigMigrateState(t *testing.T) {
+	cases := map[string]struct {
+		StateVersion int
+		ID           string
+		Attributes   map[string]string
+		Expected     map[string]string
+	}{
+		"v0_1 plain": {
+			StateVersion: 0,
+			ID:           "1234",
+			Attributes: map[string]string{
+				"gzip":          "false",
+				"base64_encode": "false",
+				"rendered":      "foo",
+			},
+			Expected: map[string]string{
+				"id":              "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+				"rendered_sha256": "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+				"raw_sha256":      "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+			},
+		},
+		"v0_1 gzip and base64": {
+			StateVersion: 0,
+			ID:           "1234",
+			Attributes: map[string]string{
+				"gzip":          "true",
+				"base64_encode": "true",
+				"rendered":      "H4sIAAAAAAAA/wADAPz/Zm9vAwAhZXOMAwAAAA==",
+			},
+			Expected: map[string]string{
+				"id":              "195c71a642a1667c42f297844f417dbe709720a076b3aaa8485fc9887d41b425",
+				"rendered_sha256": "195c71a642a1667c42f297844f417dbe709720a076b3aaa8485fc9887d41b425",
+				"raw_sha256":      "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+			},
+		},
+	}
+
+	for tn, tc := range cases {
+		is := &terraform.InstanceState{
+			ID:         tc.ID,
+			Attributes: tc.Attributes,
+		}
+		is, err := resourceCloudinitConfigMigrateState(tc.StateVersion, is, nil)
+		if err != nil {
+			t.Fatalf("bad: %s, err: %#v", tn, err)
+		}
+
+		for k, v := range tc.Expected {
+			if is.Attributes[k] != v {
+				t.Fatalf(
+					"bad: %s\n\n expected: %#v -> %#v\n got: %#v -> %#v\n in: %#v",
+					tn, k, v, k, is.Attributes[k], is.Attributes)
+			}
+		}
+		if is.ID != tc.Expected["id"] {
+			t.Fatalf("bad: %s, expected ID %s, got %s", tn, tc.Expected["id"], is.ID)
+		}
+	}
+}
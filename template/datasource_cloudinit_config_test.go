@@ -1,10 +1,20 @@
 package template
 
 import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"reflect"
 	"regexp"
+	"strings"
 	"testing"
 
 	r "github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
 )
 
 func TestRender(t *testing.T) {
@@ -53,6 +63,43 @@ func TestRender(t *testing.T) {
 			}`,
 			"Content-Type: multipart/mixed; boundary=\"MIMEBOUNDARY\"\nMIME-Version: 1.0\r\n\r\n--MIMEBOUNDARY\r\nContent-Transfer-Encoding: 7bit\r\nContent-Type: text/x-shellscript\r\nMime-Version: 1.0\r\n\r\nbaz\r\n--MIMEBOUNDARY\r\nContent-Transfer-Encoding: 7bit\r\nContent-Type: text/x-shellscript\r\nMime-Version: 1.0\r\n\r\nffbaz\r\n--MIMEBOUNDARY--\r\n",
 		},
+		{
+			`data "template_cloudinit_config" "foo" {
+				gzip = false
+				base64_encode = false
+
+				part {
+					content_type = "text/x-shellscript"
+					content = "caf\u00e9"
+				}
+			}`,
+			"Content-Type: multipart/mixed; boundary=\"MIMEBOUNDARY\"\nMIME-Version: 1.0\r\n\r\n--MIMEBOUNDARY\r\nContent-Transfer-Encoding: 8bit\r\nContent-Type: text/x-shellscript\r\nMime-Version: 1.0\r\n\r\ncaf\u00e9\r\n--MIMEBOUNDARY--\r\n",
+		},
+		{
+			`data "template_cloudinit_config" "foo" {
+				gzip = false
+				base64_encode = false
+
+				part {
+					content_type = "application/octet-stream"
+					content_base64 = "AAH/"
+				}
+			}`,
+			"Content-Type: multipart/mixed; boundary=\"MIMEBOUNDARY\"\nMIME-Version: 1.0\r\n\r\n--MIMEBOUNDARY\r\nContent-Transfer-Encoding: base64\r\nContent-Type: application/octet-stream\r\nMime-Version: 1.0\r\n\r\nAAH/\r\n--MIMEBOUNDARY--\r\n",
+		},
+		{
+			`data "template_cloudinit_config" "foo" {
+				gzip = false
+				base64_encode = false
+
+				part {
+					content_type = "text/x-shellscript"
+					content = "a=b"
+					encoding = "quoted-printable"
+				}
+			}`,
+			"Content-Type: multipart/mixed; boundary=\"MIMEBOUNDARY\"\nMIME-Version: 1.0\r\n\r\n--MIMEBOUNDARY\r\nContent-Transfer-Encoding: quoted-printable\r\nContent-Type: text/x-shellscript\r\nMime-Version: 1.0\r\n\r\na=3Db\r\n--MIMEBOUNDARY--\r\n",
+		},
 	}
 
 	for _, tt := range testCases {
@@ -90,3 +137,475 @@ data "template_cloudinit_config" "foo" {
   }
 }
 `
+
+func TestRender_encodingNot7bit(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					part {
+						content  = "caf\u00e9"
+						encoding = "7bit"
+					}
+				}`,
+				ExpectError: regexp.MustCompile("part 0: content is not 7-bit clean"),
+			},
+		},
+	})
+}
+
+func TestRender_encoding8bitBinary(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					part {
+						content_base64 = "AAH/"
+						encoding       = "8bit"
+					}
+				}`,
+				ExpectError: regexp.MustCompile("part 0: content is binary or has lines over 998 octets"),
+			},
+		},
+	})
+}
+
+func TestRender_partBody(t *testing.T) {
+	cases := map[string]struct {
+		Part      string
+		ExpectErr string
+	}{
+		"content and content_base64": {
+			Part:      `content = "a"` + "\n" + `content_base64 = "Yg=="`,
+			ExpectErr: "part 0: only one of content or content_base64 may be set",
+		},
+		"content and template": {
+			Part:      `content = "a"` + "\n" + `template = "b"`,
+			ExpectErr: "part 0: only one of content, content_base64 or template may be set",
+		},
+		"no body": {
+			Part:      `content_type = "text/x-shellscript"`,
+			ExpectErr: "part 0: one of content, content_base64 or template must be set",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r.UnitTest(t, r.TestCase{
+				Providers: testProviders,
+				Steps: []r.TestStep{
+					{
+						Config:      "data \"template_cloudinit_config\" \"foo\" {\npart {\n" + tc.Part + "\n}\n}",
+						ExpectError: regexp.MustCompile(regexp.QuoteMeta(tc.ExpectErr)),
+					},
+				},
+			})
+		})
+	}
+}
+
+func TestDetectTransferEncoding(t *testing.T) {
+	cases := map[string]string{
+		"#!/bin/sh\necho hi\n":          "7bit",
+		"echo caf\u00e9":                "8bit",
+		"\x00\x01\xff":                  "base64",
+		strings.Repeat("a", 999):        "base64",
+		strings.Repeat("a", 998) + "\n": "7bit",
+	}
+
+	for content, want := range cases {
+		if got := detectTransferEncoding(content); got != want {
+			t.Fatalf("%q: expected %s, got %s", content, want, got)
+		}
+	}
+}
+
+func TestRender_boundaryCollision(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					gzip = false
+					base64_encode = false
+
+					part {
+						content = "first\n--MIMEBOUNDARY\nstill first"
+					}
+					part {
+						content = "second"
+					}
+				}`,
+				Check: func(s *terraform.State) error {
+					rs := s.RootModule().Resources["data.template_cloudinit_config.foo"]
+					rendered := rs.Primary.Attributes["rendered"]
+
+					msg, err := mail.ReadMessage(strings.NewReader(rendered))
+					if err != nil {
+						return err
+					}
+					_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+					if err != nil {
+						return err
+					}
+					if params["boundary"] == "MIMEBOUNDARY" {
+						return fmt.Errorf("expected a derived boundary, got %q", params["boundary"])
+					}
+
+					var contents []string
+					mr := multipart.NewReader(msg.Body, params["boundary"])
+					for {
+						p, err := mr.NextPart()
+						if err == io.EOF {
+							break
+						}
+						if err != nil {
+							return err
+						}
+						b, err := ioutil.ReadAll(p)
+						if err != nil {
+							return err
+						}
+						contents = append(contents, string(b))
+					}
+
+					want := []string{"first\n--MIMEBOUNDARY\nstill first", "second"}
+					if !reflect.DeepEqual(contents, want) {
+						return fmt.Errorf("expected parts %q, got %q", want, contents)
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+func TestRender_boundaryConfigured(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					gzip = false
+					base64_encode = false
+					boundary = "CUSTOM"
+
+					part {
+						content = "baz"
+					}
+				}`,
+				Check: r.TestCheckResourceAttr("data.template_cloudinit_config.foo", "rendered",
+					"Content-Type: multipart/mixed; boundary=\"CUSTOM\"\nMIME-Version: 1.0\r\n\r\n--CUSTOM\r\nContent-Transfer-Encoding: 7bit\r\nContent-Type: text/plain\r\nMime-Version: 1.0\r\n\r\nbaz\r\n--CUSTOM--\r\n"),
+			},
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					boundary = "CUSTOM"
+
+					part {
+						content = "--CUSTOM"
+					}
+				}`,
+				ExpectError: regexp.MustCompile(`part 0: content contains the boundary "CUSTOM"`),
+			},
+		},
+	})
+}
+
+func TestSelectBoundary_deterministic(t *testing.T) {
+	parts := cloudInitParts{{Content: "--MIMEBOUNDARY"}}
+
+	first, err := selectBoundary(parts, "")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	second, err := selectBoundary(parts, "")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if first != second {
+		t.Fatalf("expected a stable boundary, got %q and %q", first, second)
+	}
+}
+
+func TestRender_maxSize(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					gzip = false
+					base64_encode = false
+					max_size = 1024
+
+					part {
+						content = "baz"
+					}
+				}`,
+				Check: r.TestCheckResourceAttrSet("data.template_cloudinit_config.foo", "rendered"),
+			},
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					gzip = false
+					base64_encode = false
+					max_size = 16
+
+					part {
+						content = "baz"
+					}
+				}`,
+				ExpectError: regexp.MustCompile(`rendered output is 195 bytes, exceeding max_size of 16 bytes \(raw: 195, gzip: \d+, base64: 260, gzip\+base64: \d+\)`),
+			},
+		},
+	})
+}
+
+func TestRender_partTemplate(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					gzip = false
+					base64_encode = false
+
+					part {
+						content_type = "text/x-shellscript"
+						template = "echo $${name}"
+						vars {
+							name = "baz"
+						}
+					}
+				}`,
+				Check: r.TestCheckResourceAttr("data.template_cloudinit_config.foo", "rendered",
+					"Content-Type: multipart/mixed; boundary=\"MIMEBOUNDARY\"\nMIME-Version: 1.0\r\n\r\n--MIMEBOUNDARY\r\nContent-Transfer-Encoding: 7bit\r\nContent-Type: text/x-shellscript\r\nMime-Version: 1.0\r\n\r\necho baz\r\n--MIMEBOUNDARY--\r\n"),
+			},
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					part {
+						content = "ok"
+					}
+					part {
+						template = "echo $${missing}"
+					}
+				}`,
+				ExpectError: regexp.MustCompile(`part 1: failed to render template: .*unknown variable accessed: missing`),
+			},
+		},
+	})
+}
+
+func TestRender_sha256(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					gzip = false
+					base64_encode = true
+
+					part {
+						content = "baz"
+					}
+				}`,
+				Check: func(s *terraform.State) error {
+					rs := s.RootModule().Resources["data.template_cloudinit_config.foo"]
+					rendered := rs.Primary.Attributes["rendered"]
+					raw, err := base64.StdEncoding.DecodeString(rendered)
+					if err != nil {
+						return err
+					}
+
+					if rs.Primary.ID != hash(rendered) {
+						return fmt.Errorf("expected ID %s, got %s", hash(rendered), rs.Primary.ID)
+					}
+					if got := rs.Primary.Attributes["rendered_sha256"]; got != hash(rendered) {
+						return fmt.Errorf("expected rendered_sha256 %s, got %s", hash(rendered), got)
+					}
+					if got := rs.Primary.Attributes["raw_sha256"]; got != hash(string(raw)) {
+						return fmt.Errorf("expected raw_sha256 %s, got %s", hash(string(raw)), got)
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+func TestRender_partHeaders(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					gzip = false
+					base64_encode = false
+
+					part {
+						content = "baz"
+						headers {
+							Launch-Index = "1"
+							X-Vendor-Flag = "on"
+						}
+					}
+				}`,
+				Check: r.TestCheckResourceAttr("data.template_cloudinit_config.foo", "rendered",
+					"Content-Type: multipart/mixed; boundary=\"MIMEBOUNDARY\"\nMIME-Version: 1.0\r\n\r\n--MIMEBOUNDARY\r\nContent-Transfer-Encoding: 7bit\r\nContent-Type: text/plain\r\nLaunch-Index: 1\r\nMime-Version: 1.0\r\nX-Vendor-Flag: on\r\n\r\nbaz\r\n--MIMEBOUNDARY--\r\n"),
+			},
+		},
+	})
+}
+
+func TestValidatePartHeaders(t *testing.T) {
+	cases := map[string]struct {
+		Headers   map[string]interface{}
+		ExpectErr string
+	}{
+		"custom headers are AOK": {
+			map[string]interface{}{"Launch-Index": "1", "X-Vendor": "on"},
+			``,
+		},
+		"renderer headers are rejected": {
+			map[string]interface{}{"x-merge-type": "list(append)"},
+			`header "x-merge-type" is set by the renderer`,
+		},
+		"invalid names are rejected": {
+			map[string]interface{}{"Bad Header": "1"},
+			`invalid header name "Bad Header"`,
+		},
+		"line breaks are rejected": {
+			map[string]interface{}{"X-Vendor": "a\r\nContent-Type: text/html"},
+			`value of header "X-Vendor" cannot contain line breaks`,
+		},
+	}
+
+	for tn, tc := range cases {
+		_, es := validatePartHeaders(tc.Headers, "headers")
+		if len(es) > 0 {
+			if tc.ExpectErr == "" {
+				t.Fatalf("%s: expected no err, got: %#v", tn, es)
+			}
+			if !strings.Contains(es[0].Error(), tc.ExpectErr) {
+				t.Fatalf("%s: expected\n%s\nto contain\n%s", tn, es[0], tc.ExpectErr)
+			}
+		} else if tc.ExpectErr != "" {
+			t.Fatalf("%s: expected err containing %q, got none!", tn, tc.ExpectErr)
+		}
+	}
+}
+
+func TestRender_instances(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					gzip = false
+					base64_encode = false
+					instances = 2
+					instance_vars = [
+						{ hostname = "web-a" },
+						{ hostname = "web-b" },
+					]
+
+					part {
+						template = "$${hostname} $${instance_index}/$${instance_count} $${role}"
+						vars {
+							role = "web"
+						}
+					}
+				}`,
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("data.template_cloudinit_config.foo", "rendered_list.#", "2"),
+					r.TestCheckResourceAttr("data.template_cloudinit_config.foo", "rendered_list.0",
+						"Content-Type: multipart/mixed; boundary=\"MIMEBOUNDARY\"\nMIME-Version: 1.0\r\n\r\n--MIMEBOUNDARY\r\nContent-Transfer-Encoding: 7bit\r\nContent-Type: text/plain\r\nMime-Version: 1.0\r\n\r\nweb-a 0/2 web\r\n--MIMEBOUNDARY--\r\n"),
+					r.TestCheckResourceAttr("data.template_cloudinit_config.foo", "rendered_list.1",
+						"Content-Type: multipart/mixed; boundary=\"MIMEBOUNDARY\"\nMIME-Version: 1.0\r\n\r\n--MIMEBOUNDARY\r\nContent-Transfer-Encoding: 7bit\r\nContent-Type: text/plain\r\nMime-Version: 1.0\r\n\r\nweb-b 1/2 web\r\n--MIMEBOUNDARY--\r\n"),
+					r.TestCheckResourceAttrPair(
+						"data.template_cloudinit_config.foo", "rendered",
+						"data.template_cloudinit_config.foo", "rendered_list.0"),
+				),
+			},
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					instances = 1
+					instance_vars = [
+						{ instance_index = "7" },
+					]
+
+					part {
+						template = "$${instance_index}"
+					}
+				}`,
+				ExpectError: regexp.MustCompile(`instance_vars.0: "instance_index" is reserved`),
+			},
+		},
+	})
+}
+
+func TestRender_instancesHashes(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					gzip = false
+					base64_encode = false
+					instances = 2
+
+					part {
+						template = "hello $${instance_index}"
+					}
+				}`,
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("data.template_cloudinit_config.foo", "rendered_list.1",
+						"Content-Type: multipart/mixed; boundary=\"MIMEBOUNDARY\"\nMIME-Version: 1.0\r\n\r\n--MIMEBOUNDARY\r\nContent-Transfer-Encoding: 7bit\r\nContent-Type: text/plain\r\nMime-Version: 1.0\r\n\r\nhello 1\r\n--MIMEBOUNDARY--\r\n"),
+					testCheckCloudinitInstancesHashes("data.template_cloudinit_config.foo"),
+				),
+			},
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					gzip = false
+					base64_encode = false
+					output_format = "windows"
+					instances = 2
+
+					part {
+						content_type = "batch"
+						template     = "echo $${instance_index}"
+					}
+
+					part {
+						content_type = "powershell"
+						template     = "Write-Host $${instance_index}"
+					}
+				}`,
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("data.template_cloudinit_config.foo", "rendered_list.1",
+						"<script>\necho 1\n</script>\n<powershell>\nWrite-Host 1\n</powershell>\n"),
+					testCheckCloudinitInstancesHashes("data.template_cloudinit_config.foo"),
+				),
+			},
+		},
+	})
+}
+
+// testCheckCloudinitInstancesHashes checks that rendered_sha256 is the hash of
+// the first instance's config, and the ID the hash of all of them.
+func testCheckCloudinitInstancesHashes(name string) r.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs := s.RootModule().Resources[name].Primary
+		var list []string
+		for i := 0; i < 2; i++ {
+			list = append(list, rs.Attributes[fmt.Sprintf("rendered_list.%d", i)])
+		}
+		if got := rs.Attributes["rendered_sha256"]; got != hash(list[0]) {
+			return fmt.Errorf("expected rendered_sha256 to be the hash of rendered_list.0, got %s", got)
+		}
+		if rs.ID != hash(strings.Join(list, "\n")) {
+			return fmt.Errorf("expected the ID to be the hash of rendered_list, got %s", rs.ID)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,282 @@
+package template
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func dataSourceCloudinitDecode() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceCloudinitDecodeRead,
+
+		Schema: map[string]*schema.Schema{
+			"user_data": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "user data to decode, optionally gzipped and base64 encoded",
+			},
+			"gzip": {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "whether the user data was gzipped",
+			},
+			"base64_encode": {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "whether the user data was base64 encoded",
+			},
+			"boundary": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "MIME boundary of the multipart document",
+			},
+			"part": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"content_type": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"content": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"content_base64": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"filename": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"merge_type": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"encoding": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"headers": {
+							Type:     schema.TypeMap,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceCloudinitDecodeRead(d *schema.ResourceData, meta interface{}) error {
+	userData := d.Get("user_data").(string)
+
+	decoded, err := decodeCloudinitConfig(userData)
+	if err != nil {
+		return err
+	}
+
+	parts := make([]map[string]interface{}, len(decoded.Parts))
+	for i, part := range decoded.Parts {
+		m := map[string]interface{}{
+			"content_type": part.ContentType,
+			"filename":     part.Filename,
+			"merge_type":   part.MergeType,
+			"encoding":     part.Encoding,
+			"headers":      part.Headers,
+		}
+		if utf8.ValidString(part.Content) {
+			m["content"] = part.Content
+		} else {
+			m["content_base64"] = base64.StdEncoding.EncodeToString([]byte(part.Content))
+		}
+		parts[i] = m
+	}
+
+	d.Set("gzip", decoded.Gzip)
+	d.Set("base64_encode", decoded.Base64)
+	d.Set("boundary", decoded.Boundary)
+	if err := d.Set("part", parts); err != nil {
+		return err
+	}
+	d.SetId(hash(userData))
+	return nil
+}
+
+// decodedCloudinitConfig is the result of reversing renderCloudinitConfig.
+type decodedCloudinitConfig struct {
+	Gzip     bool
+	Base64   bool
+	Boundary string
+	Parts    cloudInitParts
+}
+
+// decodeCloudinitConfig detects and strips base64 and gzip encoding from
+// userData and splits the resulting document into its parts. User data that
+// isn't a multipart/mixed document is returned as a single part.
+func decodeCloudinitConfig(userData string) (*decodedCloudinitConfig, error) {
+	result := &decodedCloudinitConfig{}
+	data := []byte(userData)
+
+	if decoded, ok := tryDecodeBase64(userData); ok {
+		result.Base64 = true
+		data = decoded
+	}
+
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzipped user data: %s", err)
+		}
+		data, err = ioutil.ReadAll(gzipReader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzipped user data: %s", err)
+		}
+		result.Gzip = true
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		result.Parts = cloudInitParts{singleCloudInitPart(string(data))}
+		return result, nil
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		result.Parts = cloudInitParts{singleCloudInitPart(string(data))}
+		return result, nil
+	}
+	result.Boundary = params["boundary"]
+
+	mimeReader := multipart.NewReader(msg.Body, result.Boundary)
+	for i := 0; ; i++ {
+		p, err := mimeReader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read part %d: %s", i, err)
+		}
+
+		part, err := readCloudInitPart(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read part %d: %s", i, err)
+		}
+		result.Parts = append(result.Parts, part)
+	}
+
+	return result, nil
+}
+
+func readCloudInitPart(p *multipart.Part) (cloudInitPart, error) {
+	part := cloudInitPart{
+		ContentType: p.Header.Get("Content-Type"),
+		MergeType:   p.Header.Get("X-Merge-Type"),
+		Filename:    p.FileName(),
+		Encoding:    strings.ToLower(p.Header.Get("Content-Transfer-Encoding")),
+		Headers:     map[string]string{},
+	}
+	for k := range p.Header {
+		if !renderedPartHeaders[k] {
+			part.Headers[k] = p.Header.Get(k)
+		}
+	}
+
+	var reader io.Reader = p
+	switch part.Encoding {
+	case "base64":
+		reader = base64.NewDecoder(base64.StdEncoding, p)
+	case "quoted-printable":
+		reader = quotedprintable.NewReader(p)
+	}
+
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return part, err
+	}
+	part.Content = string(content)
+
+	return part, nil
+}
+
+// singleCloudInitPart wraps user data that isn't a MIME document, guessing
+// its content type from the same prefixes cloud-init itself recognizes.
+func singleCloudInitPart(content string) cloudInitPart {
+	return cloudInitPart{
+		ContentType: detectCloudInitContentType(content),
+		Content:     content,
+	}
+}
+
+// cloudInitStartsWith maps the first line prefixes cloud-init recognizes in
+// non-MIME user data to their content types. Longer prefixes come first.
+var cloudInitStartsWith = []struct {
+	Prefix      string
+	ContentType string
+}{
+	{"#include-once", "text/x-include-once-url"},
+	{"#include", "text/x-include-url"},
+	{"#cloud-config-archive", "text/cloud-config-archive"},
+	{"#cloud-config", "text/cloud-config"},
+	{"#cloud-boothook", "text/cloud-boothook"},
+	{"#upstart-job", "text/upstart-job"},
+	{"#part-handler", "text/part-handler"},
+	{"#!", "text/x-shellscript"},
+}
+
+func detectCloudInitContentType(content string) string {
+	for _, s := range cloudInitStartsWith {
+		if strings.HasPrefix(content, s.Prefix) {
+			return s.ContentType
+		}
+	}
+	return "text/plain"
+}
+
+// tryDecodeBase64 decodes s if, ignoring line breaks, it is entirely made
+// of standard base64 and decodes to something that looks like user data.
+// Short plain text scripts such as "abcd1234" are valid base64 too, so they
+// are only decoded if the result is gzipped, a MIME document or starts with
+// a prefix cloud-init recognizes.
+func tryDecodeBase64(s string) ([]byte, bool) {
+	s = strings.NewReplacer("\r", "", "\n", "").Replace(strings.TrimSpace(s))
+	if s == "" {
+		return nil, false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || !looksLikeUserData(decoded) {
+		return nil, false
+	}
+	return decoded, true
+}
+
+func looksLikeUserData(data []byte) bool {
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		return true
+	}
+	if !utf8.Valid(data) {
+		return false
+	}
+	if detectCloudInitContentType(string(data)) != "text/plain" {
+		return true
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	_, _, err = mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	return err == nil
+}
@@ -0,0 +1,118 @@
+package template
+
+import (
+	"testing"
+
+	r "github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestCloudinitDecode_roundTrip(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			{
+				Config: testCloudinitDecodeConfig_roundTrip,
+				Check: r.ComposeTestCheckFunc(
+					r.TestCheckResourceAttr("data.template_cloudinit_decode.foo", "gzip", "true"),
+					r.TestCheckResourceAttr("data.template_cloudinit_decode.foo", "base64_encode", "true"),
+					r.TestCheckResourceAttr("data.template_cloudinit_decode.foo", "boundary", "MIMEBOUNDARY"),
+					r.TestCheckResourceAttr("data.template_cloudinit_decode.foo", "part.#", "3"),
+					r.TestCheckResourceAttr("data.template_cloudinit_decode.foo", "part.0.content_type", "text/cloud-config"),
+					r.TestCheckResourceAttr("data.template_cloudinit_decode.foo", "part.0.filename", "init.cfg"),
+					r.TestCheckResourceAttr("data.template_cloudinit_decode.foo", "part.0.merge_type", "list(append)+dict(recurse_array)"),
+					r.TestCheckResourceAttr("data.template_cloudinit_decode.foo", "part.0.content", "#cloud-config\npackages: [vim]\n"),
+					r.TestCheckResourceAttr("data.template_cloudinit_decode.foo", "part.0.headers.%", "1"),
+					r.TestCheckResourceAttr("data.template_cloudinit_decode.foo", "part.0.headers.Launch-Index", "0"),
+					r.TestCheckResourceAttr("data.template_cloudinit_decode.foo", "part.1.content_type", "text/x-shellscript"),
+					r.TestCheckResourceAttr("data.template_cloudinit_decode.foo", "part.1.content", "echo café = ok"),
+					r.TestCheckResourceAttr("data.template_cloudinit_decode.foo", "part.1.encoding", "quoted-printable"),
+					r.TestCheckResourceAttr("data.template_cloudinit_decode.foo", "part.2.content", ""),
+					r.TestCheckResourceAttr("data.template_cloudinit_decode.foo", "part.2.content_base64", "AAH/"),
+					r.TestCheckResourceAttr("data.template_cloudinit_decode.foo", "part.2.encoding", "base64"),
+				),
+			},
+		},
+	})
+}
+
+func TestDecodeCloudinitConfig_plain(t *testing.T) {
+	cases := map[string]struct {
+		UserData    string
+		Base64      bool
+		ContentType string
+		Content     string
+	}{
+		"shell script": {
+			"#!/bin/sh\necho hi\n",
+			false,
+			"text/x-shellscript",
+			"#!/bin/sh\necho hi\n",
+		},
+		"base64 cloud-config": {
+			"I2Nsb3VkLWNvbmZpZwpmb286IGJhcgo=",
+			true,
+			"text/cloud-config",
+			"#cloud-config\nfoo: bar\n",
+		},
+		"alphanumeric text": {
+			"abcd1234",
+			false,
+			"text/plain",
+			"abcd1234",
+		},
+		"short word": {
+			"test",
+			false,
+			"text/plain",
+			"test",
+		},
+	}
+
+	for tn, tc := range cases {
+		decoded, err := decodeCloudinitConfig(tc.UserData)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tn, err)
+		}
+		if decoded.Base64 != tc.Base64 || decoded.Gzip {
+			t.Fatalf("%s: bad encoding detection: %#v", tn, decoded)
+		}
+		if len(decoded.Parts) != 1 {
+			t.Fatalf("%s: expected 1 part, got %d", tn, len(decoded.Parts))
+		}
+		if decoded.Parts[0].ContentType != tc.ContentType {
+			t.Fatalf("%s: expected content type %s, got %s", tn, tc.ContentType, decoded.Parts[0].ContentType)
+		}
+		if decoded.Parts[0].Content != tc.Content {
+			t.Fatalf("%s: expected content %q, got %q", tn, tc.Content, decoded.Parts[0].Content)
+		}
+	}
+}
+
+const testCloudinitDecodeConfig_roundTrip = `
+data "template_cloudinit_config" "foo" {
+  part {
+    content_type = "text/cloud-config"
+    filename     = "init.cfg"
+    merge_type   = "list(append)+dict(recurse_array)"
+    content      = "#cloud-config\npackages: [vim]\n"
+
+    headers {
+      Launch-Index = "0"
+    }
+  }
+
+  part {
+    content_type = "text/x-shellscript"
+    content      = "echo café = ok"
+    encoding     = "quoted-printable"
+  }
+
+  part {
+    content_base64 = "AAH/"
+  }
+}
+
+data "template_cloudinit_decode" "foo" {
+  user_data = "${data.template_cloudinit_config.foo.rendered}"
+}
+`
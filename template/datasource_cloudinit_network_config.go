@@ -0,0 +1,873 @@
+package template
+
+import (
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// bondModes are the bonding modes both netplan and cloud-init accept.
+var bondModes = []string{
+	"balance-rr", "active-backup", "balance-xor", "broadcast",
+	"802.3ad", "balance-tlb", "balance-alb",
+}
+
+func dataSourceCloudinitNetworkConfig() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceCloudinitNetworkConfigRead,
+
+		Schema: map[string]*schema.Schema{
+			"version": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      2,
+				Description:  "network config format version, 1 or 2",
+				ValidateFunc: validateNetworkConfigVersion,
+			},
+			"ethernet": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: networkInterfaceSchema(map[string]*schema.Schema{
+						"match_mac": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"match_name": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"match_driver": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"set_name": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					}),
+				},
+			},
+			"bond": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: networkInterfaceSchema(map[string]*schema.Schema{
+						"interfaces": {
+							Type:     schema.TypeList,
+							Required: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+						"mode": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateBondMode,
+						},
+						"primary": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"mii_monitor_interval": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							ValidateFunc: validateNonNegative,
+						},
+						"lacp_rate": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"transmit_hash_policy": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					}),
+				},
+			},
+			"vlan": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: networkInterfaceSchema(map[string]*schema.Schema{
+						"id": {
+							Type:         schema.TypeInt,
+							Required:     true,
+							ValidateFunc: validateVlanID,
+						},
+						"link": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+					}),
+				},
+			},
+			"bridge": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: networkInterfaceSchema(map[string]*schema.Schema{
+						"interfaces": {
+							Type:     schema.TypeList,
+							Required: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+						"stp": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+						"forward_delay": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							ValidateFunc: validateNonNegative,
+						},
+					}),
+				},
+			},
+			"route": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"interface": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"to": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"via": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"metric": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							ValidateFunc: validateNonNegative,
+						},
+					},
+				},
+			},
+			"nameserver": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"interface": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"addresses": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+						"search": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+					},
+				},
+			},
+			"gzip": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"gzip_level": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      gzip.DefaultCompression,
+				ValidateFunc: validateGzipLevel,
+			},
+			"base64_encode": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"rendered": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "rendered network configuration",
+			},
+		},
+	}
+}
+
+// networkInterfaceSchema adds the attributes shared by the ethernet, bond,
+// vlan and bridge blocks to fields.
+func networkInterfaceSchema(fields map[string]*schema.Schema) map[string]*schema.Schema {
+	fields["name"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Required: true,
+	}
+	fields["mtu"] = &schema.Schema{
+		Type:         schema.TypeInt,
+		Optional:     true,
+		ValidateFunc: validateNonNegative,
+	}
+	fields["dhcp4"] = &schema.Schema{
+		Type:     schema.TypeBool,
+		Optional: true,
+	}
+	fields["dhcp6"] = &schema.Schema{
+		Type:     schema.TypeBool,
+		Optional: true,
+	}
+	fields["addresses"] = &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		Elem:     &schema.Schema{Type: schema.TypeString},
+	}
+	fields["gateway4"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+	}
+	fields["gateway6"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+	}
+	return fields
+}
+
+func dataSourceCloudinitNetworkConfigRead(d *schema.ResourceData, meta interface{}) error {
+	rendered, err := renderCloudinitNetworkConfig(d)
+	if err != nil {
+		return err
+	}
+
+	d.Set("rendered", rendered)
+	d.SetId(hash(rendered))
+	return nil
+}
+
+func renderCloudinitNetworkConfig(d *schema.ResourceData) (string, error) {
+	config := buildNetworkConfig(d)
+	if err := config.validate(); err != nil {
+		return "", err
+	}
+
+	var doc interface{}
+	if config.Version == 1 {
+		doc = config.v1()
+	} else {
+		doc = config.v2()
+	}
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+
+	if d.Get("gzip").(bool) {
+		data, err = gzipBytes(data, d.Get("gzip_level").(int))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if d.Get("base64_encode").(bool) {
+		return base64.StdEncoding.EncodeToString(data), nil
+	}
+	return string(data), nil
+}
+
+// networkConfig is the version independent model of the network
+// configuration declared in template_cloudinit_network_config.
+type networkConfig struct {
+	Version     int
+	Interfaces  []*networkInterface
+	Routes      []networkRoute
+	Nameservers []networkNameservers
+}
+
+type networkInterface struct {
+	// Kind is the block the interface was declared in and Key its position,
+	// such as "bond.0", for error messages.
+	Kind string
+	Key  string
+
+	Name      string
+	MTU       int
+	DHCP4     bool
+	DHCP6     bool
+	Addresses []string
+	Gateway4  string
+	Gateway6  string
+
+	// ethernet
+	MatchMAC    string
+	MatchName   string
+	MatchDriver string
+	SetName     string
+
+	// bond and bridge
+	Interfaces []string
+
+	// bond
+	BondMode               string
+	BondPrimary            string
+	BondMIIMonitorInterval int
+	BondLACPRate           string
+	BondTransmitHashPolicy string
+
+	// vlan
+	VlanID   int
+	VlanLink string
+
+	// bridge
+	STP          bool
+	ForwardDelay int
+}
+
+type networkRoute struct {
+	Key       string
+	Interface string
+	To        string
+	Via       string
+	Metric    int
+}
+
+type networkNameservers struct {
+	Key       string
+	Interface string
+	Addresses []string
+	Search    []string
+}
+
+func buildNetworkConfig(d *schema.ResourceData) *networkConfig {
+	config := &networkConfig{Version: d.Get("version").(int)}
+
+	for _, kind := range []string{"ethernet", "bond", "vlan", "bridge"} {
+		for i, v := range d.Get(kind).([]interface{}) {
+			m := v.(map[string]interface{})
+			iface := &networkInterface{
+				Kind:      kind,
+				Key:       fmt.Sprintf("%s.%d", kind, i),
+				Name:      m["name"].(string),
+				MTU:       m["mtu"].(int),
+				DHCP4:     m["dhcp4"].(bool),
+				DHCP6:     m["dhcp6"].(bool),
+				Addresses: stringList(m["addresses"]),
+				Gateway4:  m["gateway4"].(string),
+				Gateway6:  m["gateway6"].(string),
+			}
+
+			switch kind {
+			case "ethernet":
+				iface.MatchMAC = m["match_mac"].(string)
+				iface.MatchName = m["match_name"].(string)
+				iface.MatchDriver = m["match_driver"].(string)
+				iface.SetName = m["set_name"].(string)
+			case "bond":
+				iface.Interfaces = stringList(m["interfaces"])
+				iface.BondMode = m["mode"].(string)
+				iface.BondPrimary = m["primary"].(string)
+				iface.BondMIIMonitorInterval = m["mii_monitor_interval"].(int)
+				iface.BondLACPRate = m["lacp_rate"].(string)
+				iface.BondTransmitHashPolicy = m["transmit_hash_policy"].(string)
+			case "vlan":
+				iface.VlanID = m["id"].(int)
+				iface.VlanLink = m["link"].(string)
+			case "bridge":
+				iface.Interfaces = stringList(m["interfaces"])
+				iface.STP = m["stp"].(bool)
+				iface.ForwardDelay = m["forward_delay"].(int)
+			}
+			config.Interfaces = append(config.Interfaces, iface)
+		}
+	}
+
+	for i, v := range d.Get("route").([]interface{}) {
+		m := v.(map[string]interface{})
+		config.Routes = append(config.Routes, networkRoute{
+			Key:       fmt.Sprintf("route.%d", i),
+			Interface: m["interface"].(string),
+			To:        m["to"].(string),
+			Via:       m["via"].(string),
+			Metric:    m["metric"].(int),
+		})
+	}
+
+	for i, v := range d.Get("nameserver").([]interface{}) {
+		m := v.(map[string]interface{})
+		config.Nameservers = append(config.Nameservers, networkNameservers{
+			Key:       fmt.Sprintf("nameserver.%d", i),
+			Interface: m["interface"].(string),
+			Addresses: stringList(m["addresses"]),
+			Search:    stringList(m["search"]),
+		})
+	}
+
+	return config
+}
+
+func stringList(v interface{}) []string {
+	var list []string
+	for _, s := range v.([]interface{}) {
+		list = append(list, s.(string))
+	}
+	return list
+}
+
+// validate checks the references between blocks and the address syntax, as
+// well as the features the selected version can't express, so that mistakes
+// surface at plan time instead of at boot.
+func (c *networkConfig) validate() error {
+	byName := map[string]*networkInterface{}
+	for _, iface := range c.Interfaces {
+		if other, ok := byName[iface.Name]; ok {
+			return fmt.Errorf("%s: interface %q is already declared in %s", iface.Key, iface.Name, other.Key)
+		}
+		byName[iface.Name] = iface
+	}
+
+	for _, iface := range c.Interfaces {
+		for _, address := range iface.Addresses {
+			if _, _, err := net.ParseCIDR(address); err != nil {
+				return fmt.Errorf("%s: address %q must be in CIDR notation", iface.Key, address)
+			}
+		}
+		if iface.Gateway4 != "" {
+			if !isIPv4(iface.Gateway4) {
+				return fmt.Errorf("%s: gateway4 %q is not an IPv4 address", iface.Key, iface.Gateway4)
+			}
+			if !hasAddress(iface.Addresses, isIPv4) {
+				return fmt.Errorf("%s: gateway4 requires a static IPv4 address", iface.Key)
+			}
+		}
+		if iface.Gateway6 != "" {
+			if !isIPv6(iface.Gateway6) {
+				return fmt.Errorf("%s: gateway6 %q is not an IPv6 address", iface.Key, iface.Gateway6)
+			}
+			if !hasAddress(iface.Addresses, isIPv6) {
+				return fmt.Errorf("%s: gateway6 requires a static IPv6 address", iface.Key)
+			}
+		}
+
+		for _, member := range iface.Interfaces {
+			if _, ok := byName[member]; !ok {
+				return fmt.Errorf("%s: interface %q is not declared", iface.Key, member)
+			}
+		}
+		if iface.BondPrimary != "" && !containsString(iface.Interfaces, iface.BondPrimary) {
+			return fmt.Errorf("%s: primary %q is not one of the bonded interfaces", iface.Key, iface.BondPrimary)
+		}
+		if iface.Kind == "vlan" {
+			if _, ok := byName[iface.VlanLink]; !ok {
+				return fmt.Errorf("%s: link %q is not declared", iface.Key, iface.VlanLink)
+			}
+		}
+
+		if iface.Kind == "ethernet" {
+			hasMatch := iface.MatchMAC != "" || iface.MatchName != "" || iface.MatchDriver != ""
+			if iface.MatchMAC != "" {
+				if _, err := net.ParseMAC(iface.MatchMAC); err != nil {
+					return fmt.Errorf("%s: match_mac %q is not a MAC address", iface.Key, iface.MatchMAC)
+				}
+			}
+			if c.Version == 1 {
+				if iface.MatchMAC == "" {
+					return fmt.Errorf("%s: version 1 requires match_mac", iface.Key)
+				}
+				if iface.MatchName != "" || iface.MatchDriver != "" || iface.SetName != "" {
+					return fmt.Errorf("%s: version 1 only supports match_mac, the interface is renamed to name", iface.Key)
+				}
+			} else if iface.SetName != "" && !hasMatch {
+				return fmt.Errorf("%s: set_name requires one of match_mac, match_name or match_driver", iface.Key)
+			}
+		}
+	}
+
+	if _, err := c.ordered(); err != nil {
+		return err
+	}
+
+	for _, route := range c.Routes {
+		if _, ok := byName[route.Interface]; !ok {
+			return fmt.Errorf("%s: interface %q is not declared", route.Key, route.Interface)
+		}
+		if _, _, err := net.ParseCIDR(route.To); err != nil {
+			return fmt.Errorf("%s: to %q must be in CIDR notation", route.Key, route.To)
+		}
+		if net.ParseIP(route.Via) == nil {
+			return fmt.Errorf("%s: via %q is not an IP address", route.Key, route.Via)
+		}
+	}
+
+	for _, ns := range c.Nameservers {
+		if ns.Interface == "" && c.Version != 1 {
+			return fmt.Errorf("%s: version 2 requires interface to be set", ns.Key)
+		}
+		if _, ok := byName[ns.Interface]; ns.Interface != "" && !ok {
+			return fmt.Errorf("%s: interface %q is not declared", ns.Key, ns.Interface)
+		}
+		for _, address := range ns.Addresses {
+			if net.ParseIP(address) == nil {
+				return fmt.Errorf("%s: address %q is not an IP address", ns.Key, address)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ordered returns the interfaces sorted so that each one comes after the
+// interfaces it is built on, as version 1 requires, and errors on cycles.
+func (c *networkConfig) ordered() ([]*networkInterface, error) {
+	byName := map[string]*networkInterface{}
+	for _, iface := range c.Interfaces {
+		byName[iface.Name] = iface
+	}
+
+	var result []*networkInterface
+	state := map[string]int{} // 1: visiting, 2: done
+	var visit func(iface *networkInterface) error
+	visit = func(iface *networkInterface) error {
+		switch state[iface.Name] {
+		case 1:
+			return fmt.Errorf("%s: interface %q depends on itself", iface.Key, iface.Name)
+		case 2:
+			return nil
+		}
+		state[iface.Name] = 1
+		deps := iface.Interfaces
+		if iface.VlanLink != "" {
+			deps = append([]string{iface.VlanLink}, deps...)
+		}
+		for _, name := range deps {
+			if dep, ok := byName[name]; ok {
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		state[iface.Name] = 2
+		result = append(result, iface)
+		return nil
+	}
+
+	for _, iface := range c.Interfaces {
+		if err := visit(iface); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func isIPv4(s string) bool {
+	ip := net.ParseIP(s)
+	return ip != nil && ip.To4() != nil
+}
+
+func isIPv6(s string) bool {
+	ip := net.ParseIP(s)
+	return ip != nil && ip.To4() == nil
+}
+
+// hasAddress reports whether one of the CIDR addresses is of the family
+// matched by isFamily.
+func hasAddress(addresses []string, isFamily func(string) bool) bool {
+	for _, address := range addresses {
+		if isFamily(strings.SplitN(address, "/", 2)[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// netplanConfig is the version 2 format, a subset of netplan's.
+type netplanConfig struct {
+	Network struct {
+		Version   int                          `yaml:"version"`
+		Ethernets map[string]*netplanInterface `yaml:"ethernets,omitempty"`
+		Bonds     map[string]*netplanInterface `yaml:"bonds,omitempty"`
+		Vlans     map[string]*netplanInterface `yaml:"vlans,omitempty"`
+		Bridges   map[string]*netplanInterface `yaml:"bridges,omitempty"`
+	} `yaml:"network"`
+}
+
+type netplanInterface struct {
+	Match       *netplanMatch          `yaml:"match,omitempty"`
+	SetName     string                 `yaml:"set-name,omitempty"`
+	Interfaces  []string               `yaml:"interfaces,omitempty"`
+	ID          int                    `yaml:"id,omitempty"`
+	Link        string                 `yaml:"link,omitempty"`
+	Parameters  map[string]interface{} `yaml:"parameters,omitempty"`
+	MTU         int                    `yaml:"mtu,omitempty"`
+	DHCP4       bool                   `yaml:"dhcp4,omitempty"`
+	DHCP6       bool                   `yaml:"dhcp6,omitempty"`
+	Addresses   []string               `yaml:"addresses,omitempty"`
+	Gateway4    string                 `yaml:"gateway4,omitempty"`
+	Gateway6    string                 `yaml:"gateway6,omitempty"`
+	Routes      []netplanRoute         `yaml:"routes,omitempty"`
+	Nameservers *netplanNameservers    `yaml:"nameservers,omitempty"`
+}
+
+type netplanMatch struct {
+	MACAddress string `yaml:"macaddress,omitempty"`
+	Name       string `yaml:"name,omitempty"`
+	Driver     string `yaml:"driver,omitempty"`
+}
+
+type netplanRoute struct {
+	To     string `yaml:"to"`
+	Via    string `yaml:"via"`
+	Metric int    `yaml:"metric,omitempty"`
+}
+
+type netplanNameservers struct {
+	Addresses []string `yaml:"addresses,omitempty"`
+	Search    []string `yaml:"search,omitempty"`
+}
+
+func (c *networkConfig) v2() *netplanConfig {
+	config := &netplanConfig{}
+	config.Network.Version = 2
+
+	byName := map[string]*netplanInterface{}
+	for _, iface := range c.Interfaces {
+		n := &netplanInterface{
+			Interfaces: iface.Interfaces,
+			MTU:        iface.MTU,
+			DHCP4:      iface.DHCP4,
+			DHCP6:      iface.DHCP6,
+			Addresses:  iface.Addresses,
+			Gateway4:   iface.Gateway4,
+			Gateway6:   iface.Gateway6,
+		}
+		byName[iface.Name] = n
+
+		var group *map[string]*netplanInterface
+		switch iface.Kind {
+		case "ethernet":
+			group = &config.Network.Ethernets
+			if iface.MatchMAC != "" || iface.MatchName != "" || iface.MatchDriver != "" {
+				n.Match = &netplanMatch{
+					MACAddress: iface.MatchMAC,
+					Name:       iface.MatchName,
+					Driver:     iface.MatchDriver,
+				}
+			}
+			n.SetName = iface.SetName
+		case "bond":
+			group = &config.Network.Bonds
+			n.Parameters = map[string]interface{}{}
+			if iface.BondMode != "" {
+				n.Parameters["mode"] = iface.BondMode
+			}
+			if iface.BondPrimary != "" {
+				n.Parameters["primary"] = iface.BondPrimary
+			}
+			if iface.BondMIIMonitorInterval != 0 {
+				n.Parameters["mii-monitor-interval"] = iface.BondMIIMonitorInterval
+			}
+			if iface.BondLACPRate != "" {
+				n.Parameters["lacp-rate"] = iface.BondLACPRate
+			}
+			if iface.BondTransmitHashPolicy != "" {
+				n.Parameters["transmit-hash-policy"] = iface.BondTransmitHashPolicy
+			}
+		case "vlan":
+			group = &config.Network.Vlans
+			n.ID = iface.VlanID
+			n.Link = iface.VlanLink
+		case "bridge":
+			group = &config.Network.Bridges
+			n.Parameters = map[string]interface{}{"stp": iface.STP}
+			if iface.ForwardDelay != 0 {
+				n.Parameters["forward-delay"] = iface.ForwardDelay
+			}
+		}
+		if *group == nil {
+			*group = map[string]*netplanInterface{}
+		}
+		(*group)[iface.Name] = n
+	}
+
+	for _, route := range c.Routes {
+		n := byName[route.Interface]
+		n.Routes = append(n.Routes, netplanRoute{To: route.To, Via: route.Via, Metric: route.Metric})
+	}
+
+	for _, ns := range c.Nameservers {
+		n := byName[ns.Interface]
+		if n.Nameservers == nil {
+			n.Nameservers = &netplanNameservers{}
+		}
+		n.Nameservers.Addresses = append(n.Nameservers.Addresses, ns.Addresses...)
+		n.Nameservers.Search = append(n.Nameservers.Search, ns.Search...)
+	}
+
+	return config
+}
+
+// networkConfigV1 is cloud-init's own version 1 format.
+type networkConfigV1 struct {
+	Network struct {
+		Version int                    `yaml:"version"`
+		Config  []networkConfigV1Entry `yaml:"config"`
+	} `yaml:"network"`
+}
+
+type networkConfigV1Entry struct {
+	Type             string                  `yaml:"type"`
+	Name             string                  `yaml:"name,omitempty"`
+	MACAddress       string                  `yaml:"mac_address,omitempty"`
+	MTU              int                     `yaml:"mtu,omitempty"`
+	BondInterfaces   []string                `yaml:"bond_interfaces,omitempty"`
+	BridgeInterfaces []string                `yaml:"bridge_interfaces,omitempty"`
+	VlanLink         string                  `yaml:"vlan_link,omitempty"`
+	VlanID           int                     `yaml:"vlan_id,omitempty"`
+	Params           map[string]interface{}  `yaml:"params,omitempty"`
+	Subnets          []networkConfigV1Subnet `yaml:"subnets,omitempty"`
+	Destination      string                  `yaml:"destination,omitempty"`
+	Gateway          string                  `yaml:"gateway,omitempty"`
+	Metric           int                     `yaml:"metric,omitempty"`
+	Address          []string                `yaml:"address,omitempty"`
+	Search           []string                `yaml:"search,omitempty"`
+	Interface        string                  `yaml:"interface,omitempty"`
+}
+
+type networkConfigV1Subnet struct {
+	Type    string `yaml:"type"`
+	Address string `yaml:"address,omitempty"`
+	Gateway string `yaml:"gateway,omitempty"`
+}
+
+func (c *networkConfig) v1() *networkConfigV1 {
+	config := &networkConfigV1{}
+	config.Network.Version = 1
+
+	// validate already rejected dependency cycles.
+	interfaces, _ := c.ordered()
+	for _, iface := range interfaces {
+		entry := networkConfigV1Entry{
+			Name:    iface.Name,
+			MTU:     iface.MTU,
+			Subnets: v1Subnets(iface),
+		}
+
+		switch iface.Kind {
+		case "ethernet":
+			entry.Type = "physical"
+			entry.MACAddress = iface.MatchMAC
+		case "bond":
+			entry.Type = "bond"
+			entry.BondInterfaces = iface.Interfaces
+			entry.Params = map[string]interface{}{}
+			if iface.BondMode != "" {
+				entry.Params["bond-mode"] = iface.BondMode
+			}
+			if iface.BondPrimary != "" {
+				entry.Params["bond-primary"] = iface.BondPrimary
+			}
+			if iface.BondMIIMonitorInterval != 0 {
+				entry.Params["bond-miimon"] = iface.BondMIIMonitorInterval
+			}
+			if iface.BondLACPRate != "" {
+				entry.Params["bond-lacp-rate"] = iface.BondLACPRate
+			}
+			if iface.BondTransmitHashPolicy != "" {
+				entry.Params["bond-xmit-hash-policy"] = iface.BondTransmitHashPolicy
+			}
+		case "vlan":
+			entry.Type = "vlan"
+			entry.VlanLink = iface.VlanLink
+			entry.VlanID = iface.VlanID
+		case "bridge":
+			entry.Type = "bridge"
+			entry.BridgeInterfaces = iface.Interfaces
+			entry.Params = map[string]interface{}{"bridge_stp": "off"}
+			if iface.STP {
+				entry.Params["bridge_stp"] = "on"
+			}
+			if iface.ForwardDelay != 0 {
+				entry.Params["bridge_fd"] = iface.ForwardDelay
+			}
+		}
+		config.Network.Config = append(config.Network.Config, entry)
+	}
+
+	// Version 1 routes are global, the gateway selects the interface.
+	for _, route := range c.Routes {
+		config.Network.Config = append(config.Network.Config, networkConfigV1Entry{
+			Type:        "route",
+			Destination: route.To,
+			Gateway:     route.Via,
+			Metric:      route.Metric,
+		})
+	}
+
+	for _, ns := range c.Nameservers {
+		config.Network.Config = append(config.Network.Config, networkConfigV1Entry{
+			Type:      "nameserver",
+			Address:   ns.Addresses,
+			Search:    ns.Search,
+			Interface: ns.Interface,
+		})
+	}
+
+	return config
+}
+
+// v1Subnets returns a subnet per DHCP protocol and static address, with the
+// gateways attached to the first static subnet of their address family.
+func v1Subnets(iface *networkInterface) []networkConfigV1Subnet {
+	var subnets []networkConfigV1Subnet
+	if iface.DHCP4 {
+		subnets = append(subnets, networkConfigV1Subnet{Type: "dhcp4"})
+	}
+	if iface.DHCP6 {
+		subnets = append(subnets, networkConfigV1Subnet{Type: "dhcp6"})
+	}
+
+	gateway4, gateway6 := iface.Gateway4, iface.Gateway6
+	for _, address := range iface.Addresses {
+		subnet := networkConfigV1Subnet{Type: "static", Address: address}
+		ip, _, _ := net.ParseCIDR(address)
+		if ip.To4() != nil {
+			subnet.Gateway, gateway4 = gateway4, ""
+		} else {
+			subnet.Type = "static6"
+			subnet.Gateway, gateway6 = gateway6, ""
+		}
+		subnets = append(subnets, subnet)
+	}
+	return subnets
+}
+
+func validateNetworkConfigVersion(v interface{}, key string) (ws []string, es []error) {
+	if version := v.(int); version != 1 && version != 2 {
+		es = append(es, fmt.Errorf("%s: must be 1 or 2, got %d", key, version))
+	}
+	return
+}
+
+func validateBondMode(v interface{}, key string) (ws []string, es []error) {
+	if !containsString(bondModes, v.(string)) {
+		es = append(es, fmt.Errorf("%s: must be one of %s, got %q", key, strings.Join(bondModes, ", "), v.(string)))
+	}
+	return
+}
+
+func validateVlanID(v interface{}, key string) (ws []string, es []error) {
+	if id := v.(int); id < 1 || id > 4094 {
+		es = append(es, fmt.Errorf("%s: must be between 1 and 4094, got %d", key, id))
+	}
+	return
+}
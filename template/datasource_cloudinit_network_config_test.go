@@ -0,0 +1,340 @@
+package template
+
+import (
+	"strings"
+	"testing"
+
+	r "github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestRenderCloudinitNetworkConfig(t *testing.T) {
+	testCases := []struct {
+		Name           string
+		ResourceBlock  string
+		ExpectedOutput string
+	}{
+		{
+			"version 2",
+			`data "template_cloudinit_network_config" "foo" {
+			  ethernet {
+			    name      = "eth0"
+			    match_mac = "52:54:00:12:34:00"
+			    set_name  = "eth0"
+			  }
+			  ethernet {
+			    name      = "eth1"
+			    match_mac = "52:54:00:12:34:01"
+			  }
+			  bond {
+			    name                 = "bond0"
+			    interfaces           = ["eth0", "eth1"]
+			    mode                 = "active-backup"
+			    primary              = "eth0"
+			    mii_monitor_interval = 100
+			    dhcp4                = true
+			  }
+			  vlan {
+			    name      = "bond0.10"
+			    id        = 10
+			    link      = "bond0"
+			    addresses = ["10.0.10.2/24", "fd00::2/64"]
+			    gateway4  = "10.0.10.1"
+			  }
+			  bridge {
+			    name       = "br0"
+			    interfaces = ["bond0.10"]
+			    stp        = false
+			  }
+			  route {
+			    interface = "bond0.10"
+			    to        = "192.168.0.0/16"
+			    via       = "10.0.10.254"
+			    metric    = 100
+			  }
+			  nameserver {
+			    interface = "bond0.10"
+			    addresses = ["10.0.10.53"]
+			    search    = ["example.com"]
+			  }
+			}`,
+			`network:
+  version: 2
+  ethernets:
+    eth0:
+      match:
+        macaddress: "52:54:00:12:34:00"
+      set-name: eth0
+    eth1:
+      match:
+        macaddress: "52:54:00:12:34:01"
+  bonds:
+    bond0:
+      interfaces:
+      - eth0
+      - eth1
+      parameters:
+        mii-monitor-interval: 100
+        mode: active-backup
+        primary: eth0
+      dhcp4: true
+  vlans:
+    bond0.10:
+      id: 10
+      link: bond0
+      addresses:
+      - 10.0.10.2/24
+      - fd00::2/64
+      gateway4: 10.0.10.1
+      routes:
+      - to: 192.168.0.0/16
+        via: 10.0.10.254
+        metric: 100
+      nameservers:
+        addresses:
+        - 10.0.10.53
+        search:
+        - example.com
+  bridges:
+    br0:
+      interfaces:
+      - bond0.10
+      parameters:
+        stp: false
+`,
+		},
+		{
+			"version 1",
+			`data "template_cloudinit_network_config" "foo" {
+			  version = 1
+
+			  bridge {
+			    name       = "br0"
+			    interfaces = ["eth0.10"]
+			    dhcp6      = true
+			  }
+			  vlan {
+			    name = "eth0.10"
+			    id   = 10
+			    link = "eth0"
+			  }
+			  ethernet {
+			    name      = "eth0"
+			    match_mac = "52:54:00:12:34:00"
+			    mtu       = 9000
+			    addresses = ["10.0.0.2/24", "10.0.1.2/24"]
+			    gateway4  = "10.0.0.1"
+			  }
+			  route {
+			    interface = "eth0"
+			    to        = "192.168.0.0/16"
+			    via       = "10.0.0.254"
+			  }
+			  nameserver {
+			    addresses = ["10.0.0.53"]
+			  }
+			}`,
+			`network:
+  version: 1
+  config:
+  - type: physical
+    name: eth0
+    mac_address: "52:54:00:12:34:00"
+    mtu: 9000
+    subnets:
+    - type: static
+      address: 10.0.0.2/24
+      gateway: 10.0.0.1
+    - type: static
+      address: 10.0.1.2/24
+  - type: vlan
+    name: eth0.10
+    vlan_link: eth0
+    vlan_id: 10
+  - type: bridge
+    name: br0
+    bridge_interfaces:
+    - eth0.10
+    params:
+      bridge_stp: "on"
+    subnets:
+    - type: dhcp6
+  - type: route
+    destination: 192.168.0.0/16
+    gateway: 10.0.0.254
+  - type: nameserver
+    address:
+    - 10.0.0.53
+`,
+		},
+		{
+			"gzip and base64",
+			`data "template_cloudinit_network_config" "foo" {
+			  ethernet {
+			    name  = "eth0"
+			    dhcp4 = true
+			  }
+			  gzip          = true
+			  base64_encode = true
+			}`,
+			"H4sIAAAAAAAA/wA/AMD/bmV0d29yazoKICB2ZXJzaW9uOiAyCiAgZXRoZXJuZXRzOgogICAgZXRoMDoKICAgICAgZGhjcDQ6IHRydWUKAwAlnDcyPwAAAA==",
+		},
+	}
+
+	for _, tt := range testCases {
+		r.UnitTest(t, r.TestCase{
+			Providers: testProviders,
+			Steps: []r.TestStep{
+				{
+					Config: tt.ResourceBlock,
+					Check: r.ComposeTestCheckFunc(
+						r.TestCheckResourceAttr("data.template_cloudinit_network_config.foo", "rendered", tt.ExpectedOutput),
+					),
+				},
+			},
+		})
+	}
+}
+
+func TestNetworkConfigValidate(t *testing.T) {
+	ethernet := func(name string) *networkInterface {
+		return &networkInterface{Kind: "ethernet", Key: "ethernet.0", Name: name, MatchMAC: "52:54:00:12:34:00"}
+	}
+
+	cases := map[string]struct {
+		Config *networkConfig
+		Error  string
+	}{
+		"valid": {
+			&networkConfig{Version: 2, Interfaces: []*networkInterface{ethernet("eth0")}},
+			"",
+		},
+		"duplicate name": {
+			&networkConfig{Version: 2, Interfaces: []*networkInterface{
+				ethernet("eth0"),
+				{Kind: "bond", Key: "bond.0", Name: "eth0"},
+			}},
+			`bond.0: interface "eth0" is already declared in ethernet.0`,
+		},
+		"address without prefix": {
+			&networkConfig{Version: 2, Interfaces: []*networkInterface{
+				{Kind: "ethernet", Key: "ethernet.0", Name: "eth0", Addresses: []string{"10.0.0.2"}},
+			}},
+			`ethernet.0: address "10.0.0.2" must be in CIDR notation`,
+		},
+		"gateway without address": {
+			&networkConfig{Version: 2, Interfaces: []*networkInterface{
+				{Kind: "ethernet", Key: "ethernet.0", Name: "eth0", DHCP4: true, Gateway4: "10.0.0.1"},
+			}},
+			"ethernet.0: gateway4 requires a static IPv4 address",
+		},
+		"gateway6 family": {
+			&networkConfig{Version: 2, Interfaces: []*networkInterface{
+				{Kind: "ethernet", Key: "ethernet.0", Name: "eth0", Gateway6: "10.0.0.1"},
+			}},
+			`ethernet.0: gateway6 "10.0.0.1" is not an IPv6 address`,
+		},
+		"undeclared bond member": {
+			&networkConfig{Version: 2, Interfaces: []*networkInterface{
+				{Kind: "bond", Key: "bond.0", Name: "bond0", Interfaces: []string{"eth9"}},
+			}},
+			`bond.0: interface "eth9" is not declared`,
+		},
+		"bond primary": {
+			&networkConfig{Version: 2, Interfaces: []*networkInterface{
+				ethernet("eth0"),
+				{Kind: "bond", Key: "bond.0", Name: "bond0", Interfaces: []string{"eth0"}, BondPrimary: "eth1"},
+			}},
+			`bond.0: primary "eth1" is not one of the bonded interfaces`,
+		},
+		"undeclared vlan link": {
+			&networkConfig{Version: 2, Interfaces: []*networkInterface{
+				{Kind: "vlan", Key: "vlan.0", Name: "vlan10", VlanID: 10, VlanLink: "eth0"},
+			}},
+			`vlan.0: link "eth0" is not declared`,
+		},
+		"cycle": {
+			&networkConfig{Version: 2, Interfaces: []*networkInterface{
+				{Kind: "bridge", Key: "bridge.0", Name: "br0", Interfaces: []string{"br1"}},
+				{Kind: "bridge", Key: "bridge.1", Name: "br1", Interfaces: []string{"br0"}},
+			}},
+			`bridge.0: interface "br0" depends on itself`,
+		},
+		"set_name without match": {
+			&networkConfig{Version: 2, Interfaces: []*networkInterface{
+				{Kind: "ethernet", Key: "ethernet.0", Name: "eth0", SetName: "lan"},
+			}},
+			"ethernet.0: set_name requires one of match_mac, match_name or match_driver",
+		},
+		"version 1 without mac": {
+			&networkConfig{Version: 1, Interfaces: []*networkInterface{
+				{Kind: "ethernet", Key: "ethernet.0", Name: "eth0"},
+			}},
+			"ethernet.0: version 1 requires match_mac",
+		},
+		"version 1 match_name": {
+			&networkConfig{Version: 1, Interfaces: []*networkInterface{
+				{Kind: "ethernet", Key: "ethernet.0", Name: "eth0", MatchMAC: "52:54:00:12:34:00", MatchName: "en*"},
+			}},
+			"ethernet.0: version 1 only supports match_mac, the interface is renamed to name",
+		},
+		"bad mac": {
+			&networkConfig{Version: 2, Interfaces: []*networkInterface{
+				{Kind: "ethernet", Key: "ethernet.0", Name: "eth0", MatchMAC: "nope"},
+			}},
+			`ethernet.0: match_mac "nope" is not a MAC address`,
+		},
+		"route to undeclared interface": {
+			&networkConfig{Version: 2, Routes: []networkRoute{
+				{Key: "route.0", Interface: "eth0", To: "10.0.0.0/8", Via: "10.0.0.1"},
+			}},
+			`route.0: interface "eth0" is not declared`,
+		},
+		"route via": {
+			&networkConfig{Version: 2, Interfaces: []*networkInterface{ethernet("eth0")}, Routes: []networkRoute{
+				{Key: "route.0", Interface: "eth0", To: "10.0.0.0/8", Via: "gateway"},
+			}},
+			`route.0: via "gateway" is not an IP address`,
+		},
+		"version 2 global nameserver": {
+			&networkConfig{Version: 2, Nameservers: []networkNameservers{
+				{Key: "nameserver.0", Addresses: []string{"10.0.0.53"}},
+			}},
+			"nameserver.0: version 2 requires interface to be set",
+		},
+		"version 1 global nameserver": {
+			&networkConfig{Version: 1, Nameservers: []networkNameservers{
+				{Key: "nameserver.0", Addresses: []string{"10.0.0.53"}},
+			}},
+			"",
+		},
+		"nameserver address": {
+			&networkConfig{Version: 1, Nameservers: []networkNameservers{
+				{Key: "nameserver.0", Addresses: []string{"dns.example.com"}},
+			}},
+			`nameserver.0: address "dns.example.com" is not an IP address`,
+		},
+	}
+
+	for tn, tc := range cases {
+		err := tc.Config.validate()
+		switch {
+		case tc.Error == "" && err != nil:
+			t.Fatalf("%s: unexpected error: %s", tn, err)
+		case tc.Error != "" && err == nil:
+			t.Fatalf("%s: expected error %q, got none", tn, tc.Error)
+		case tc.Error != "" && !strings.Contains(err.Error(), tc.Error):
+			t.Fatalf("%s: expected error %q, got %q", tn, tc.Error, err)
+		}
+	}
+}
+
+func TestValidateVlanID(t *testing.T) {
+	for _, id := range []int{0, 4095} {
+		if _, es := validateVlanID(id, "id"); len(es) == 0 {
+			t.Fatalf("expected an error for VLAN ID %d", id)
+		}
+	}
+	if _, es := validateVlanID(4094, "id"); len(es) != 0 {
+		t.Fatalf("unexpected errors: %v", es)
+	}
+}
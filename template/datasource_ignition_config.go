@@ -0,0 +1,562 @@
+package template
+
+import (
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+const ignitionVersion = "3.0.0"
+
+// ignitionUnitSuffixes are the systemd unit types Ignition accepts.
+var ignitionUnitSuffixes = []string{
+	".service", ".socket", ".device", ".mount", ".automount", ".swap",
+	".target", ".path", ".timer", ".snapshot", ".slice", ".scope",
+}
+
+func dataSourceIgnitionConfig() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceIgnitionConfigRead,
+
+		Schema: map[string]*schema.Schema{
+			"files": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"path": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"content": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"source": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"mode": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateIgnitionMode,
+						},
+						"overwrite": {
+							Type:     schema.TypeBool,
+							Optional: true,
+						},
+						"user": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"group": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					},
+				},
+			},
+			"directories": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"path": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"mode": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateIgnitionMode,
+						},
+						"overwrite": {
+							Type:     schema.TypeBool,
+							Optional: true,
+						},
+						"user": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"group": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					},
+				},
+			},
+			"links": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"path": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"target": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"hard": {
+							Type:     schema.TypeBool,
+							Optional: true,
+						},
+						"overwrite": {
+							Type:     schema.TypeBool,
+							Optional: true,
+						},
+						"user": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"group": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					},
+				},
+			},
+			"systemd_units": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"enabled": {
+							Type:     schema.TypeBool,
+							Optional: true,
+						},
+						"mask": {
+							Type:     schema.TypeBool,
+							Optional: true,
+						},
+						"content": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"dropin": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"name": {
+										Type:     schema.TypeString,
+										Required: true,
+									},
+									"content": {
+										Type:     schema.TypeString,
+										Required: true,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			"users": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"password_hash": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"ssh_authorized_keys": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+						"groups": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+						"uid": {
+							Type:     schema.TypeInt,
+							Optional: true,
+						},
+						"gecos": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"home_dir": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"shell": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					},
+				},
+			},
+			"gzip": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"base64_encode": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"rendered": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "rendered ignition configuration",
+			},
+		},
+	}
+}
+
+func dataSourceIgnitionConfigRead(d *schema.ResourceData, meta interface{}) error {
+	rendered, err := renderIgnitionConfig(d)
+	if err != nil {
+		return err
+	}
+
+	d.Set("rendered", rendered)
+	d.SetId(hash(rendered))
+	return nil
+}
+
+func renderIgnitionConfig(d *schema.ResourceData) (string, error) {
+	config, err := buildIgnitionConfig(d)
+	if err != nil {
+		return "", err
+	}
+	if err := config.validate(); err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	if d.Get("gzip").(bool) {
+		data, err = gzipBytes(data, gzip.DefaultCompression)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if d.Get("base64_encode").(bool) {
+		return base64.StdEncoding.EncodeToString(data), nil
+	}
+	return string(data), nil
+}
+
+func buildIgnitionConfig(d *schema.ResourceData) (*ignitionConfig, error) {
+	config := &ignitionConfig{}
+	config.Ignition.Version = ignitionVersion
+
+	for i, v := range d.Get("files").([]interface{}) {
+		f := v.(map[string]interface{})
+		node := ignitionNodeFromMap(f)
+
+		mode, err := ignitionModeFromMap(f)
+		if err != nil {
+			return nil, fmt.Errorf("files.%d: %s", i, err)
+		}
+		file := ignitionFile{ignitionNode: node, Mode: mode}
+
+		content := f["content"].(string)
+		source := f["source"].(string)
+		switch {
+		case content != "" && source != "":
+			return nil, fmt.Errorf("files.%d: only one of content or source may be set", i)
+		case source != "":
+			file.Contents = &ignitionResource{Source: &source}
+		default:
+			dataURL := "data:;base64," + base64.StdEncoding.EncodeToString([]byte(content))
+			file.Contents = &ignitionResource{Source: &dataURL}
+		}
+		config.Storage.Files = append(config.Storage.Files, file)
+	}
+
+	for i, v := range d.Get("directories").([]interface{}) {
+		m := v.(map[string]interface{})
+		node := ignitionNodeFromMap(m)
+
+		mode, err := ignitionModeFromMap(m)
+		if err != nil {
+			return nil, fmt.Errorf("directories.%d: %s", i, err)
+		}
+		dir := ignitionDirectory{ignitionNode: node, Mode: mode}
+		config.Storage.Directories = append(config.Storage.Directories, dir)
+	}
+
+	for _, v := range d.Get("links").([]interface{}) {
+		m := v.(map[string]interface{})
+		node := ignitionNodeFromMap(m)
+
+		link := ignitionLink{ignitionNode: node, Target: m["target"].(string)}
+		if m["hard"].(bool) {
+			link.Hard = boolPtr(true)
+		}
+		config.Storage.Links = append(config.Storage.Links, link)
+	}
+
+	for _, v := range d.Get("systemd_units").([]interface{}) {
+		m := v.(map[string]interface{})
+		unit := ignitionUnit{Name: m["name"].(string)}
+		if m["enabled"].(bool) {
+			unit.Enabled = boolPtr(true)
+		}
+		if m["mask"].(bool) {
+			unit.Mask = boolPtr(true)
+		}
+		if content := m["content"].(string); content != "" {
+			unit.Contents = &content
+		}
+		for _, v := range m["dropin"].([]interface{}) {
+			dm := v.(map[string]interface{})
+			content := dm["content"].(string)
+			unit.Dropins = append(unit.Dropins, ignitionDropin{
+				Name:     dm["name"].(string),
+				Contents: &content,
+			})
+		}
+		config.Systemd.Units = append(config.Systemd.Units, unit)
+	}
+
+	for _, v := range d.Get("users").([]interface{}) {
+		m := v.(map[string]interface{})
+		user := ignitionUser{Name: m["name"].(string)}
+		if s := m["password_hash"].(string); s != "" {
+			user.PasswordHash = &s
+		}
+		for _, key := range m["ssh_authorized_keys"].([]interface{}) {
+			user.SSHAuthorizedKeys = append(user.SSHAuthorizedKeys, key.(string))
+		}
+		for _, group := range m["groups"].([]interface{}) {
+			user.Groups = append(user.Groups, group.(string))
+		}
+		if uid := m["uid"].(int); uid != 0 {
+			user.UID = &uid
+		}
+		if s := m["gecos"].(string); s != "" {
+			user.Gecos = &s
+		}
+		if s := m["home_dir"].(string); s != "" {
+			user.HomeDir = &s
+		}
+		if s := m["shell"].(string); s != "" {
+			user.Shell = &s
+		}
+		config.Passwd.Users = append(config.Passwd.Users, user)
+	}
+
+	return config, nil
+}
+
+func ignitionNodeFromMap(m map[string]interface{}) ignitionNode {
+	node := ignitionNode{Path: m["path"].(string)}
+	if m["overwrite"].(bool) {
+		node.Overwrite = boolPtr(true)
+	}
+	if user := m["user"].(string); user != "" {
+		node.User = &ignitionNodeUser{Name: &user}
+	}
+	if group := m["group"].(string); group != "" {
+		node.Group = &ignitionNodeUser{Name: &group}
+	}
+	return node
+}
+
+func ignitionModeFromMap(m map[string]interface{}) (*int, error) {
+	s := m["mode"].(string)
+	if s == "" {
+		return nil, nil
+	}
+	mode, err := strconv.ParseInt(s, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mode %q: %s", s, err)
+	}
+	i := int(mode)
+	return &i, nil
+}
+
+func validateIgnitionMode(v interface{}, key string) (ws []string, es []error) {
+	if v.(string) == "" {
+		return
+	}
+	mode, err := strconv.ParseInt(v.(string), 8, 32)
+	if err != nil || mode < 0 || mode > 07777 {
+		es = append(es, fmt.Errorf("%s: must be an octal file mode such as 0644, got %q", key, v.(string)))
+	}
+	return
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// ignitionConfig is the subset of the Ignition v3 config spec that
+// template_ignition_config can render.
+type ignitionConfig struct {
+	Ignition struct {
+		Version string `json:"version"`
+	} `json:"ignition"`
+	Passwd struct {
+		Users []ignitionUser `json:"users,omitempty"`
+	} `json:"passwd"`
+	Storage struct {
+		Directories []ignitionDirectory `json:"directories,omitempty"`
+		Files       []ignitionFile      `json:"files,omitempty"`
+		Links       []ignitionLink      `json:"links,omitempty"`
+	} `json:"storage"`
+	Systemd struct {
+		Units []ignitionUnit `json:"units,omitempty"`
+	} `json:"systemd"`
+}
+
+type ignitionNode struct {
+	Path      string            `json:"path"`
+	Overwrite *bool             `json:"overwrite,omitempty"`
+	User      *ignitionNodeUser `json:"user,omitempty"`
+	Group     *ignitionNodeUser `json:"group,omitempty"`
+}
+
+type ignitionNodeUser struct {
+	Name *string `json:"name,omitempty"`
+}
+
+type ignitionResource struct {
+	Source *string `json:"source,omitempty"`
+}
+
+type ignitionFile struct {
+	ignitionNode
+	Contents *ignitionResource `json:"contents,omitempty"`
+	Mode     *int              `json:"mode,omitempty"`
+}
+
+type ignitionDirectory struct {
+	ignitionNode
+	Mode *int `json:"mode,omitempty"`
+}
+
+type ignitionLink struct {
+	ignitionNode
+	Target string `json:"target"`
+	Hard   *bool  `json:"hard,omitempty"`
+}
+
+type ignitionUnit struct {
+	Name     string           `json:"name"`
+	Enabled  *bool            `json:"enabled,omitempty"`
+	Mask     *bool            `json:"mask,omitempty"`
+	Contents *string          `json:"contents,omitempty"`
+	Dropins  []ignitionDropin `json:"dropins,omitempty"`
+}
+
+type ignitionDropin struct {
+	Name     string  `json:"name"`
+	Contents *string `json:"contents,omitempty"`
+}
+
+type ignitionUser struct {
+	Name              string   `json:"name"`
+	PasswordHash      *string  `json:"passwordHash,omitempty"`
+	SSHAuthorizedKeys []string `json:"sshAuthorizedKeys,omitempty"`
+	Groups            []string `json:"groups,omitempty"`
+	UID               *int     `json:"uid,omitempty"`
+	Gecos             *string  `json:"gecos,omitempty"`
+	HomeDir           *string  `json:"homeDir,omitempty"`
+	Shell             *string  `json:"shell,omitempty"`
+}
+
+// validate applies the checks Ignition itself performs when it parses a
+// config, so that mistakes surface at plan time instead of at boot.
+func (c *ignitionConfig) validate() error {
+	paths := map[string]string{}
+	checkPath := func(kind string, i int, p string) error {
+		if !path.IsAbs(p) {
+			return fmt.Errorf("%s.%d: path %q must be absolute", kind, i, p)
+		}
+		if path.Clean(p) != p {
+			return fmt.Errorf("%s.%d: path %q must be clean, use %q", kind, i, p, path.Clean(p))
+		}
+		if other, ok := paths[p]; ok {
+			return fmt.Errorf("%s.%d: path %q is already declared in %s", kind, i, p, other)
+		}
+		paths[p] = fmt.Sprintf("%s.%d", kind, i)
+		return nil
+	}
+
+	for i, f := range c.Storage.Files {
+		if err := checkPath("files", i, f.Path); err != nil {
+			return err
+		}
+	}
+	for i, dir := range c.Storage.Directories {
+		if err := checkPath("directories", i, dir.Path); err != nil {
+			return err
+		}
+	}
+	for i, link := range c.Storage.Links {
+		if err := checkPath("links", i, link.Path); err != nil {
+			return err
+		}
+		if link.Hard != nil && *link.Hard && !path.IsAbs(link.Target) {
+			return fmt.Errorf("links.%d: hard link target %q must be absolute", i, link.Target)
+		}
+	}
+
+	units := map[string]bool{}
+	for i, unit := range c.Systemd.Units {
+		if !hasIgnitionUnitSuffix(unit.Name) {
+			return fmt.Errorf("systemd_units.%d: invalid unit name %q, must end in one of %s",
+				i, unit.Name, strings.Join(ignitionUnitSuffixes, ", "))
+		}
+		if units[unit.Name] {
+			return fmt.Errorf("systemd_units.%d: unit %q is declared more than once", i, unit.Name)
+		}
+		units[unit.Name] = true
+
+		if unit.Mask != nil && *unit.Mask && unit.Enabled != nil && *unit.Enabled {
+			return fmt.Errorf("systemd_units.%d: unit %q cannot be both masked and enabled", i, unit.Name)
+		}
+		for j, dropin := range unit.Dropins {
+			if path.Ext(dropin.Name) != ".conf" {
+				return fmt.Errorf("systemd_units.%d.dropin.%d: invalid dropin name %q, must end in .conf", i, j, dropin.Name)
+			}
+		}
+	}
+
+	users := map[string]bool{}
+	for i, user := range c.Passwd.Users {
+		if users[user.Name] {
+			return fmt.Errorf("users.%d: user %q is declared more than once", i, user.Name)
+		}
+		users[user.Name] = true
+	}
+
+	return nil
+}
+
+func hasIgnitionUnitSuffix(name string) bool {
+	for _, suffix := range ignitionUnitSuffixes {
+		if strings.HasSuffix(name, suffix) && len(name) > len(suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package template
+
+import (
+	"regexp"
+	"testing"
+
+	r "github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestIgnitionConfigRender(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			{
+				Config: testIgnitionConfig_full,
+				Check: r.TestCheckResourceAttr("data.template_ignition_config.foo", "rendered",
+					`{"ignition":{"version":"3.0.0"},`+
+						`"passwd":{"users":[{"name":"core","sshAuthorizedKeys":["ssh-rsa AAAA"],"groups":["docker"]}]},`+
+						`"storage":{`+
+						`"directories":[{"path":"/opt/app","mode":493}],`+
+						`"files":[{"path":"/etc/hostname","overwrite":true,"contents":{"source":"data:;base64,d2ViMQ=="},"mode":420}],`+
+						`"links":[{"path":"/etc/localtime","target":"/usr/share/zoneinfo/UTC"}]},`+
+						`"systemd":{"units":[{"name":"app.service","enabled":true,"contents":"[Service]\nExecStart=/opt/app/run\n",`+
+						`"dropins":[{"name":"10-env.conf","contents":"[Service]\nEnvironment=A=b\n"}]}]}}`),
+			},
+		},
+	})
+}
+
+func TestIgnitionConfigValidation(t *testing.T) {
+	cases := map[string]struct {
+		Config    string
+		ExpectErr string
+	}{
+		"relative path": {
+			`files { path = "etc/hostname" }`,
+			`files.0: path "etc/hostname" must be absolute`,
+		},
+		"duplicate path": {
+			`files { path = "/opt/app" }
+			 directories { path = "/opt/app" }`,
+			`directories.0: path "/opt/app" is already declared in files.0`,
+		},
+		"bad unit name": {
+			`systemd_units { name = "app" }`,
+			`systemd_units.0: invalid unit name "app"`,
+		},
+		"bad mode": {
+			`files {
+				path = "/etc/hostname"
+				mode = "0999"
+			}`,
+			`must be an octal file mode`,
+		},
+	}
+
+	for _, tc := range cases {
+		r.UnitTest(t, r.TestCase{
+			Providers: testProviders,
+			Steps: []r.TestStep{
+				{
+					Config:      `data "template_ignition_config" "foo" {` + tc.Config + `}`,
+					ExpectError: regexp.MustCompile(regexp.QuoteMeta(tc.ExpectErr)),
+				},
+			},
+		})
+	}
+}
+
+const testIgnitionConfig_full = `
+data "template_ignition_config" "foo" {
+  files {
+    path      = "/etc/hostname"
+    content   = "web1"
+    mode      = "0644"
+    overwrite = true
+  }
+
+  directories {
+    path = "/opt/app"
+    mode = "0755"
+  }
+
+  links {
+    path   = "/etc/localtime"
+    target = "/usr/share/zoneinfo/UTC"
+  }
+
+  systemd_units {
+    name    = "app.service"
+    enabled = true
+    content = "[Service]\nExecStart=/opt/app/run\n"
+
+    dropin {
+      name    = "10-env.conf"
+      content = "[Service]\nEnvironment=A=b\n"
+    }
+  }
+
+  users {
+    name                = "core"
+    ssh_authorized_keys = ["ssh-rsa AAAA"]
+    groups              = ["docker"]
+  }
+}
+`
@@ -1,7 +1,9 @@
 package template
 
 import (
+	"compress/gzip"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"os"
@@ -10,8 +12,6 @@ import (
 
 	"github.com/hashicorp/hil"
 	"github.com/hashicorp/hil/ast"
-	"github.com/hashicorp/terraform/config"
-	"github.com/hashicorp/terraform/helper/pathorcontents"
 	"github.com/hashicorp/terraform/helper/schema"
 )
 
@@ -55,6 +55,31 @@ func dataSourceFile() *schema.Resource {
 				Description:  "variables to substitute",
 				ValidateFunc: validateVarsAttribute,
 			},
+			"max_size": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Description:  "maximum size in bytes of the rendered template",
+				ValidateFunc: validateNonNegative,
+			},
+			"normalize": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "none",
+				Description:  "whitespace normalization applied to the template and its output",
+				ValidateFunc: validateNormalize,
+			},
+			"allowed_functions": &schema.Schema{
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "interpolation functions the template may call, all if unset",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"deny_nondeterministic": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "whether to deny functions such as timestamp() and uuid()",
+			},
 			"rendered": &schema.Schema{
 				Type:        schema.TypeString,
 				Computed:    true,
@@ -65,7 +90,7 @@ func dataSourceFile() *schema.Resource {
 }
 
 func dataSourceFileRead(d *schema.ResourceData, meta interface{}) error {
-	rendered, err := renderFile(d)
+	rendered, err := renderFile(d, providerConfigFromMeta(meta).forResource(d))
 	if err != nil {
 		return err
 	}
@@ -76,14 +101,15 @@ func dataSourceFileRead(d *schema.ResourceData, meta interface{}) error {
 
 type templateRenderError error
 
-func renderFile(d *schema.ResourceData) (string, error) {
+func renderFile(d *schema.ResourceData, provider *providerConfig) (string, error) {
 	template := d.Get("template").(string)
 	filename := d.Get("filename").(string)
 	vars := d.Get("vars").(map[string]interface{})
+	normalize := d.Get("normalize").(string)
 
 	contents := template
 	if template == "" && filename != "" {
-		data, _, err := pathorcontents.Read(filename)
+		data, err := provider.readFile(filename)
 		if err != nil {
 			return "", err
 		}
@@ -91,23 +117,47 @@ func renderFile(d *schema.ResourceData) (string, error) {
 		contents = data
 	}
 
-	rendered, err := execute(contents, vars)
+	rendered, err := execute(normalizeText(contents, normalize), vars, provider)
 	if err != nil {
 		return "", templateRenderError(
 			fmt.Errorf("failed to render %v: %v", filename, err),
 		)
 	}
+	rendered = normalizeText(rendered, normalize)
+
+	if err := checkRenderedSize(d.Get("max_size").(int), []byte(rendered), rendered, gzip.DefaultCompression); err != nil {
+		return "", err
+	}
 
 	return rendered, nil
 }
 
-// execute parses and executes a template using vars.
-func execute(s string, vars map[string]interface{}) (string, error) {
+// execute parses and executes a template using vars, merged with the
+// provider variables. Only the functions allowed by the provider function
+// policy may be called, and file() only reads within the provider sandbox.
+func execute(s string, vars map[string]interface{}, provider *providerConfig) (string, error) {
 	root, err := hil.Parse(s)
 	if err != nil {
 		return "", err
 	}
 
+	policy := provider.functions()
+	funcs, err := policy.funcMap(provider.userFunctions())
+	if err != nil {
+		return "", err
+	}
+	if err := policy.checkCalls(root, provider.userFunctions()); err != nil {
+		return "", err
+	}
+	if _, ok := funcs["file"]; ok && provider.sandboxed() {
+		funcs["file"] = provider.fileFunc()
+	}
+
+	vars, err = provider.templateVars(vars)
+	if err != nil {
+		return "", err
+	}
+
 	varmap := make(map[string]ast.Variable)
 	for k, v := range vars {
 		// As far as I can tell, v is always a string.
@@ -125,7 +175,7 @@ func execute(s string, vars map[string]interface{}) (string, error) {
 	cfg := hil.EvalConfig{
 		GlobalScope: &ast.BasicScope{
 			VarMap:  varmap,
-			FuncMap: config.Funcs(),
+			FuncMap: funcs,
 		},
 	}
 
@@ -145,6 +195,76 @@ func hash(s string) string {
 	return hex.EncodeToString(sha[:])
 }
 
+// checkRenderedSize returns an error if rendered exceeds maxSize bytes. The
+// error reports the size of raw under each combination of gzip and base64 so
+// that the user can pick one that fits, gzipping at gzipLevel. A maxSize of
+// zero disables the check.
+func checkRenderedSize(maxSize int, raw []byte, rendered string, gzipLevel int) error {
+	if maxSize == 0 || len(rendered) <= maxSize {
+		return nil
+	}
+
+	gzipped, err := gzipBytes(raw, gzipLevel)
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf(
+		"rendered output is %d bytes, exceeding max_size of %d bytes "+
+			"(raw: %d, gzip: %d, base64: %d, gzip+base64: %d)",
+		len(rendered), maxSize, len(raw), len(gzipped),
+		base64.StdEncoding.EncodedLen(len(raw)),
+		base64.StdEncoding.EncodedLen(len(gzipped)))
+}
+
+// normalizeText applies a whitespace normalization mode to s: "lf" converts
+// CRLF and CR line endings to LF, "trim_trailing" removes spaces and tabs at
+// the end of each line and "lf_trim" does both. "none" returns s unchanged.
+func normalizeText(s, mode string) string {
+	switch mode {
+	case "lf":
+		return toLF(s)
+	case "trim_trailing":
+		return trimTrailingWhitespace(s)
+	case "lf_trim":
+		return trimTrailingWhitespace(toLF(s))
+	}
+	return s
+}
+
+func toLF(s string) string {
+	return strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(s)
+}
+
+func trimTrailingWhitespace(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.HasSuffix(line, "\r") {
+			lines[i] = strings.TrimRight(line[:len(line)-1], " \t") + "\r"
+		} else {
+			lines[i] = strings.TrimRight(line, " \t")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func validateNormalize(v interface{}, key string) (ws []string, es []error) {
+	switch v.(string) {
+	case "none", "trim_trailing", "lf", "lf_trim":
+	default:
+		es = append(es, fmt.Errorf(
+			"%s: must be one of none, trim_trailing, lf or lf_trim, got %q", key, v.(string)))
+	}
+	return
+}
+
+func validateNonNegative(v interface{}, key string) (ws []string, es []error) {
+	if v.(int) < 0 {
+		es = append(es, fmt.Errorf("%s: cannot be negative", key))
+	}
+	return
+}
+
 func validateVarsAttribute(v interface{}, key string) (ws []string, es []error) {
 	// vars can only be primitives right now
 	var badVars []string
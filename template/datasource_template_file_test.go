@@ -2,6 +2,7 @@ package template
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 	"sync"
 	"testing"
@@ -46,6 +47,72 @@ func TestTemplateRendering(t *testing.T) {
 	}
 }
 
+func TestTemplateMaxSize(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: `data "template_file" "t0" {
+					template = "0123456789"
+					max_size = 4
+				}`,
+				ExpectError: regexp.MustCompile(`rendered output is 10 bytes, exceeding max_size of 4 bytes \(raw: 10, gzip: \d+, base64: 16, gzip\+base64: \d+\)`),
+			},
+		},
+	})
+}
+
+func TestTemplateNormalize(t *testing.T) {
+	cases := []struct {
+		Mode     string
+		Input    string
+		Expected string
+	}{
+		{"none", "a \r\nb\t\n", "a \r\nb\t\n"},
+		{"lf", "a \r\nb\rc\n", "a \nb\nc\n"},
+		{"trim_trailing", "a \r\nb\t\n c", "a\r\nb\n c"},
+		{"lf_trim", "a \r\nb\t\r c \n", "a\nb\n c\n"},
+	}
+
+	for _, tc := range cases {
+		if got := normalizeText(tc.Input, tc.Mode); got != tc.Expected {
+			t.Fatalf("%s: expected %q, got %q", tc.Mode, tc.Expected, got)
+		}
+	}
+}
+
+func TestTemplateNormalizeStableID(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: `data "template_file" "clean" {
+					template  = "a\nb $${x}\n"
+					vars      = { x = "c" }
+					normalize = "lf_trim"
+				}
+				data "template_file" "dirty" {
+					template  = "a  \r\nb $${x}\r\n"
+					vars      = { x = "c \t" }
+					normalize = "lf_trim"
+				}`,
+				Check: func(s *terraform.State) error {
+					clean := s.RootModule().Resources["data.template_file.clean"].Primary
+					dirty := s.RootModule().Resources["data.template_file.dirty"].Primary
+					if clean.Attributes["rendered"] != "a\nb c\n" {
+						return fmt.Errorf("unexpected rendered output %q", clean.Attributes["rendered"])
+					}
+					if dirty.Attributes["rendered"] != clean.Attributes["rendered"] || dirty.ID != clean.ID {
+						return fmt.Errorf("expected %q (%s), got %q (%s)",
+							clean.Attributes["rendered"], clean.ID, dirty.Attributes["rendered"], dirty.ID)
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
 func TestValidateVarsAttribute(t *testing.T) {
 	cases := map[string]struct {
 		Vars      map[string]interface{}
@@ -99,12 +166,12 @@ func TestTemplateSharedMemoryRace(t *testing.T) {
 	for i := 0; i < 100; i++ {
 		wg.Add(1)
 		go func(t *testing.T, i int) {
-			out, err := execute("don't panic!", map[string]interface{}{})
+			out, err := execute("don't panic!", map[string]interface{}{}, nil)
 			if err != nil {
-				t.Fatalf("err: %s", err)
+				t.Errorf("err: %s", err)
 			}
 			if out != "don't panic!" {
-				t.Fatalf("bad output: %s", out)
+				t.Errorf("bad output: %s", out)
 			}
 			wg.Done()
 		}(t, i)
@@ -0,0 +1,232 @@
+package template
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+const isoSectorSize = 2048
+
+// isoFile is a file in the root directory of an ISO 9660 image.
+type isoFile struct {
+	Name    string
+	Content []byte
+}
+
+// writeISO9660 builds an ISO 9660 image holding files in its root directory.
+// Besides the primary volume descriptor, a Joliet supplementary descriptor
+// records the file names verbatim, as genisoimage -J does, so names such as
+// "user-data" survive on every platform. All timestamps are fixed, so the
+// image only depends on its label and files.
+func writeISO9660(label string, files []isoFile) []byte {
+	sorted := make([]isoFile, len(files))
+	copy(sorted, files)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	// Fixed layout: system area, three volume descriptors, four path tables
+	// and two root directories, followed by the file contents.
+	const (
+		pvdSector         = 16
+		jolietSector      = 17
+		terminatorSector  = 18
+		pathTableLSector  = 19
+		pathTableMSector  = 20
+		jolietLSector     = 21
+		jolietMSector     = 22
+		rootSector        = 23
+		jolietRootSector  = 24
+		firstExtentSector = 25
+	)
+
+	extents := make([]uint32, len(sorted))
+	next := uint32(firstExtentSector)
+	for i, f := range sorted {
+		if len(f.Content) == 0 {
+			continue
+		}
+		extents[i] = next
+		next += uint32((len(f.Content) + isoSectorSize - 1) / isoSectorSize)
+	}
+	totalSectors := next
+
+	image := make([]byte, int(totalSectors)*isoSectorSize)
+	sector := func(n int) []byte {
+		return image[n*isoSectorSize : (n+1)*isoSectorSize]
+	}
+
+	primaryNames := make([][]byte, len(sorted))
+	jolietNames := make([][]byte, len(sorted))
+	for i, f := range sorted {
+		primaryNames[i] = []byte(isoPrimaryName(f.Name))
+		jolietNames[i] = ucs2(f.Name + ";1")
+	}
+
+	writeRootDirectory(sector(rootSector), rootSector, sorted, primaryNames, extents)
+	writeRootDirectory(sector(jolietRootSector), jolietRootSector, sorted, jolietNames, extents)
+
+	writePathTable(sector(pathTableLSector), rootSector, binary.LittleEndian)
+	writePathTable(sector(pathTableMSector), rootSector, binary.BigEndian)
+	writePathTable(sector(jolietLSector), jolietRootSector, binary.LittleEndian)
+	writePathTable(sector(jolietMSector), jolietRootSector, binary.BigEndian)
+
+	writeVolumeDescriptor(sector(pvdSector), isoVolumeDescriptor{
+		Type:         1,
+		Label:        isoPadded([]byte(strings.ToUpper(label)), 32, ' '),
+		System:       isoPadded(nil, 32, ' '),
+		TotalSectors: totalSectors,
+		PathTableL:   pathTableLSector,
+		PathTableM:   pathTableMSector,
+		RootSector:   rootSector,
+		TextPadding:  ' ',
+	})
+	writeVolumeDescriptor(sector(jolietSector), isoVolumeDescriptor{
+		Type:         2,
+		Label:        isoPadded(ucs2(label), 32, 0),
+		System:       isoPadded(nil, 32, 0),
+		TotalSectors: totalSectors,
+		PathTableL:   jolietLSector,
+		PathTableM:   jolietMSector,
+		RootSector:   jolietRootSector,
+		TextPadding:  0,
+		// UCS-2 level 3
+		EscapeSequences: []byte("%/E"),
+	})
+
+	terminator := sector(terminatorSector)
+	terminator[0] = 255
+	copy(terminator[1:6], "CD001")
+	terminator[6] = 1
+
+	for i, f := range sorted {
+		copy(image[int(extents[i])*isoSectorSize:], f.Content)
+	}
+
+	return image
+}
+
+type isoVolumeDescriptor struct {
+	Type            byte
+	Label           []byte
+	System          []byte
+	TotalSectors    uint32
+	PathTableL      uint32
+	PathTableM      uint32
+	RootSector      uint32
+	TextPadding     byte
+	EscapeSequences []byte
+}
+
+func writeVolumeDescriptor(b []byte, vd isoVolumeDescriptor) {
+	b[0] = vd.Type
+	copy(b[1:6], "CD001")
+	b[6] = 1
+	copy(b[8:40], vd.System)
+	copy(b[40:72], vd.Label)
+	putBothEndian32(b[80:88], vd.TotalSectors)
+	copy(b[88:120], vd.EscapeSequences)
+	putBothEndian16(b[120:124], 1)
+	putBothEndian16(b[124:128], 1)
+	putBothEndian16(b[128:132], isoSectorSize)
+	putBothEndian32(b[132:140], isoPathTableSize)
+	binary.LittleEndian.PutUint32(b[140:144], vd.PathTableL)
+	binary.BigEndian.PutUint32(b[148:152], vd.PathTableM)
+	writeDirectoryRecord(b[156:190], []byte{0}, vd.RootSector, isoSectorSize, true)
+
+	// Volume set, publisher, preparer and application identifiers, followed
+	// by the copyright, abstract and bibliographic file identifiers.
+	if vd.TextPadding != 0 {
+		for i := 190; i < 813; i++ {
+			b[i] = vd.TextPadding
+		}
+	}
+
+	// Creation, modification, expiration and effective dates are all "not
+	// specified": sixteen '0' digits and a zero timezone offset.
+	for i := 813; i < 881; i += 17 {
+		copy(b[i:i+16], "0000000000000000")
+	}
+	b[881] = 1
+}
+
+const isoPathTableSize = 10
+
+// writePathTable writes a path table holding only the root directory.
+func writePathTable(b []byte, rootSector uint32, order binary.ByteOrder) {
+	b[0] = 1
+	order.PutUint32(b[2:6], rootSector)
+	order.PutUint16(b[6:8], 1)
+}
+
+func writeRootDirectory(b []byte, rootSector uint32, files []isoFile, names [][]byte, extents []uint32) {
+	offset := writeDirectoryRecord(b, []byte{0}, rootSector, isoSectorSize, true)
+	offset += writeDirectoryRecord(b[offset:], []byte{1}, rootSector, isoSectorSize, true)
+	for i, f := range files {
+		offset += writeDirectoryRecord(b[offset:], names[i], extents[i], uint32(len(f.Content)), false)
+	}
+}
+
+// writeDirectoryRecord writes a directory record and returns its length.
+func writeDirectoryRecord(b []byte, name []byte, extent, size uint32, dir bool) int {
+	length := 33 + len(name)
+	if len(name)%2 == 0 {
+		length++
+	}
+
+	b[0] = byte(length)
+	putBothEndian32(b[2:10], extent)
+	putBothEndian32(b[10:18], size)
+	// 1970-01-01 00:00:00 UTC
+	copy(b[18:25], []byte{70, 1, 1, 0, 0, 0, 0})
+	if dir {
+		b[25] = 2
+	}
+	putBothEndian16(b[28:32], 1)
+	b[32] = byte(len(name))
+	copy(b[33:], name)
+	return length
+}
+
+// isoPrimaryName returns the identifier of name in the primary directory.
+// Like genisoimage -relaxed-filenames it only upper-cases the name and adds
+// the version suffix, which Linux maps back to the original name.
+func isoPrimaryName(name string) string {
+	name = strings.ToUpper(name)
+	if !strings.Contains(name, ".") {
+		name += "."
+	}
+	return name + ";1"
+}
+
+func isoPadded(b []byte, size int, pad byte) []byte {
+	padded := bytes.Repeat([]byte{pad}, size)
+	if pad == 0 {
+		// Joliet fields are padded with UCS-2 spaces.
+		for i := 1; i < size; i += 2 {
+			padded[i] = ' '
+		}
+	}
+	copy(padded, b)
+	return padded
+}
+
+func ucs2(s string) []byte {
+	encoded := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(encoded))
+	for i, c := range encoded {
+		binary.BigEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+func putBothEndian16(b []byte, v uint16) {
+	binary.LittleEndian.PutUint16(b[0:2], v)
+	binary.BigEndian.PutUint16(b[2:4], v)
+}
+
+func putBothEndian32(b []byte, v uint32) {
+	binary.LittleEndian.PutUint32(b[0:4], v)
+	binary.BigEndian.PutUint32(b[4:8], v)
+}
@@ -0,0 +1,90 @@
+package template
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestWriteISO9660(t *testing.T) {
+	files := []isoFile{
+		{Name: "user-data", Content: []byte("#cloud-config\nhostname: foo\n")},
+		{Name: "meta-data", Content: bytes.Repeat([]byte("x"), 3000)},
+		{Name: "network-config", Content: nil},
+	}
+	image := writeISO9660("cidata", files)
+
+	if len(image)%isoSectorSize != 0 {
+		t.Fatalf("image size %d is not a multiple of the sector size", len(image))
+	}
+
+	pvd := image[16*isoSectorSize:]
+	if pvd[0] != 1 || string(pvd[1:6]) != "CD001" {
+		t.Fatalf("bad primary volume descriptor: %q", pvd[:7])
+	}
+	if label := string(bytes.TrimRight(pvd[40:72], " ")); label != "CIDATA" {
+		t.Fatalf("expected primary label CIDATA, got %q", label)
+	}
+	if size := binary.LittleEndian.Uint32(pvd[80:84]); int(size)*isoSectorSize != len(image) {
+		t.Fatalf("volume space size %d doesn't match image size %d", size, len(image))
+	}
+
+	svd := image[17*isoSectorSize:]
+	if svd[0] != 2 || string(svd[88:91]) != "%/E" {
+		t.Fatalf("bad joliet volume descriptor: %q", svd[:7])
+	}
+	if label := decodeUCS2(bytes.TrimRight(svd[40:72], "\x00 ")); label != "cidata" {
+		t.Fatalf("expected joliet label cidata, got %q", label)
+	}
+
+	got := readISORoot(t, image, svd, decodeUCS2)
+	for _, f := range files {
+		content, ok := got[f.Name+";1"]
+		if !ok {
+			t.Fatalf("file %s not found in joliet directory, got %v", f.Name, got)
+		}
+		if !bytes.Equal(content, f.Content) {
+			t.Fatalf("file %s: expected %q, got %q", f.Name, f.Content, content)
+		}
+	}
+
+	got = readISORoot(t, image, pvd, func(b []byte) string { return string(b) })
+	if _, ok := got["USER-DATA.;1"]; !ok {
+		t.Fatalf("USER-DATA.;1 not found in primary directory, got %v", got)
+	}
+
+	if !bytes.Equal(image, writeISO9660("cidata", files)) {
+		t.Fatalf("expected identical images for identical input")
+	}
+}
+
+// readISORoot returns the files in the root directory of the volume
+// described by vd.
+func readISORoot(t *testing.T, image, vd []byte, decodeName func([]byte) string) map[string][]byte {
+	root := vd[156:190]
+	extent := binary.LittleEndian.Uint32(root[2:6])
+	size := binary.LittleEndian.Uint32(root[10:14])
+	dir := image[int(extent)*isoSectorSize : int(extent)*isoSectorSize+int(size)]
+
+	files := map[string][]byte{}
+	for offset := 0; offset < len(dir) && dir[offset] != 0; offset += int(dir[offset]) {
+		record := dir[offset:]
+		if record[25]&2 != 0 {
+			continue
+		}
+		name := decodeName(record[33 : 33+int(record[32])])
+		start := int(binary.LittleEndian.Uint32(record[2:6])) * isoSectorSize
+		length := int(binary.LittleEndian.Uint32(record[10:14]))
+		files[name] = image[start : start+length]
+	}
+	return files
+}
+
+func decodeUCS2(b []byte) string {
+	chars := make([]uint16, len(b)/2)
+	for i := range chars {
+		chars[i] = binary.BigEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(chars))
+}
@@ -1,15 +1,83 @@
 package template
 
 import (
+	"fmt"
+	"regexp"
+	"strings"
+
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
 )
 
 func Provider() terraform.ResourceProvider {
 	return &schema.Provider{
+		Schema: map[string]*schema.Schema{
+			"vars": {
+				Type:         schema.TypeMap,
+				Optional:     true,
+				Description:  "variables available to every template",
+				ValidateFunc: validateVarsAttribute,
+			},
+			"vars_prefix": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "namespace of the provider variables, such as global for global.env",
+				ValidateFunc: validateVarsPrefix,
+			},
+			"base_dir": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "directory relative template paths are resolved against",
+			},
+			"allowed_paths": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "directories templates may read files from, base_dir if unset",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"function": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "functions templates may call",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"params": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Description: "parameter names, optionally suffixed with :string, :int, :float or :bool",
+							Elem:        &schema.Schema{Type: schema.TypeString},
+						},
+						"body": {
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "HIL expression evaluating to the result of the function",
+						},
+					},
+				},
+			},
+			"allowed_functions": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "interpolation functions templates may call, all if unset",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"deny_nondeterministic": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "whether to deny functions such as timestamp() and uuid()",
+			},
+		},
 		DataSourcesMap: map[string]*schema.Resource{
-			"template_file":             dataSourceFile(),
-			"template_cloudinit_config": dataSourceCloudinitConfig(),
+			"template_file":                     dataSourceFile(),
+			"template_cloudinit_config":         dataSourceCloudinitConfig(),
+			"template_cloudinit_network_config": dataSourceCloudinitNetworkConfig(),
+			"template_cloudinit_decode":         dataSourceCloudinitDecode(),
+			"template_ignition_config":          dataSourceIgnitionConfig(),
 		},
 		ResourcesMap: map[string]*schema.Resource{
 			"template_file": schema.DataSourceResourceShim(
@@ -20,7 +88,111 @@ func Provider() terraform.ResourceProvider {
 				"template_cloudinit_config",
 				dataSourceCloudinitConfig(),
 			),
-			"template_dir": resourceDir(),
+			"template_dir":            resourceDir(),
+			"template_cloudinit_seed": resourceCloudinitSeed(),
 		},
+		ConfigureFunc: providerConfigure,
+	}
+}
+
+// providerConfig holds the provider settings shared by all templates. A nil
+// *providerConfig is valid and adds nothing to the templates.
+type providerConfig struct {
+	Vars       map[string]interface{}
+	VarsPrefix string
+	Functions  functionPolicy
+
+	// UserFunctions are the functions declared in function blocks.
+	UserFunctions map[string]*userFunction
+
+	// BaseDir and AllowedPaths are real paths, see configureSandbox.
+	BaseDir      string
+	AllowedPaths []string
+}
+
+func providerConfigure(d *schema.ResourceData) (interface{}, error) {
+	config := &providerConfig{
+		Vars:       d.Get("vars").(map[string]interface{}),
+		VarsPrefix: d.Get("vars_prefix").(string),
+		Functions:  functionPolicyFromData(d),
+	}
+	err := config.configureSandbox(d.Get("base_dir").(string), stringList(d.Get("allowed_paths")))
+	if err != nil {
+		return nil, err
+	}
+	config.UserFunctions, err = readUserFunctions(d.Get("function").([]interface{}))
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// forResource returns the configuration to render the templates of d with,
+// further restricting the functions they may call by the allowed_functions
+// and deny_nondeterministic attributes of d.
+func (c *providerConfig) forResource(d *schema.ResourceData) *providerConfig {
+	result := &providerConfig{}
+	if c != nil {
+		*result = *c
+	}
+	result.Functions = result.Functions.restrict(functionPolicyFromData(d))
+	return result
+}
+
+// functions returns the function policy of the provider.
+func (c *providerConfig) functions() functionPolicy {
+	if c == nil {
+		return functionPolicy{}
+	}
+	return c.Functions
+}
+
+// userFunctions returns the functions declared in the provider.
+func (c *providerConfig) userFunctions() map[string]*userFunction {
+	if c == nil {
+		return nil
+	}
+	return c.UserFunctions
+}
+
+// templateVars merges the provider variables with the variables of a
+// template. Without a prefix, template variables take precedence over
+// provider variables of the same name. With a prefix, provider variables are
+// only visible as "<prefix>.<name>" and that namespace is reserved.
+func (c *providerConfig) templateVars(vars map[string]interface{}) (map[string]interface{}, error) {
+	merged := make(map[string]interface{}, len(vars))
+	if c != nil {
+		for k, v := range c.Vars {
+			if c.VarsPrefix != "" {
+				k = c.VarsPrefix + "." + k
+			}
+			merged[k] = v
+		}
+	}
+
+	for k, v := range vars {
+		if c != nil && c.VarsPrefix != "" && (k == c.VarsPrefix || strings.HasPrefix(k, c.VarsPrefix+".")) {
+			return nil, fmt.Errorf("variable %q conflicts with the provider vars_prefix %q", k, c.VarsPrefix)
+		}
+		merged[k] = v
+	}
+	return merged, nil
+}
+
+// providerConfigFromMeta returns the provider configuration passed to CRUD
+// functions as meta.
+func providerConfigFromMeta(meta interface{}) *providerConfig {
+	config, _ := meta.(*providerConfig)
+	return config
+}
+
+var varsPrefixPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+func validateVarsPrefix(v interface{}, key string) (ws []string, es []error) {
+	if prefix := v.(string); prefix != "" && !varsPrefixPattern.MatchString(prefix) {
+		es = append(es, fmt.Errorf(
+			"%s: must start with a letter or underscore and only contain letters, digits, underscores and dashes, got %q",
+			key, prefix))
 	}
+	return
 }
@@ -1,9 +1,15 @@
 package template
 
 import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 
+	r "github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
 )
 
 func TestProvider(t *testing.T) {
@@ -11,3 +17,134 @@ func TestProvider(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 }
+
+func TestProviderConfigTemplateVars(t *testing.T) {
+	cases := map[string]struct {
+		Config    *providerConfig
+		Vars      map[string]interface{}
+		Expected  map[string]interface{}
+		ExpectErr string
+	}{
+		"nil config": {
+			Config:   nil,
+			Vars:     map[string]interface{}{"a": "1"},
+			Expected: map[string]interface{}{"a": "1"},
+		},
+		"template vars take precedence": {
+			Config:   &providerConfig{Vars: map[string]interface{}{"a": "provider", "b": "provider"}},
+			Vars:     map[string]interface{}{"a": "template"},
+			Expected: map[string]interface{}{"a": "template", "b": "provider"},
+		},
+		"prefixed": {
+			Config:   &providerConfig{Vars: map[string]interface{}{"env": "prod"}, VarsPrefix: "global"},
+			Vars:     map[string]interface{}{"env": "dev"},
+			Expected: map[string]interface{}{"global.env": "prod", "env": "dev"},
+		},
+		"prefixed conflict": {
+			Config:    &providerConfig{Vars: map[string]interface{}{"env": "prod"}, VarsPrefix: "global"},
+			Vars:      map[string]interface{}{"global.env": "dev"},
+			ExpectErr: `variable "global.env" conflicts with the provider vars_prefix "global"`,
+		},
+		"prefix itself": {
+			Config:    &providerConfig{VarsPrefix: "global"},
+			Vars:      map[string]interface{}{"global": "dev"},
+			ExpectErr: `variable "global" conflicts with the provider vars_prefix "global"`,
+		},
+		"prefix lookalike": {
+			Config:   &providerConfig{VarsPrefix: "global"},
+			Vars:     map[string]interface{}{"globally": "yes"},
+			Expected: map[string]interface{}{"globally": "yes"},
+		},
+	}
+
+	for tn, tc := range cases {
+		got, err := tc.Config.templateVars(tc.Vars)
+		if tc.ExpectErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.ExpectErr) {
+				t.Fatalf("%s: expected error %q, got %v", tn, tc.ExpectErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tn, err)
+		}
+		if !reflect.DeepEqual(got, tc.Expected) {
+			t.Fatalf("%s: expected %#v, got %#v", tn, tc.Expected, got)
+		}
+	}
+}
+
+func TestValidateVarsPrefix(t *testing.T) {
+	for _, prefix := range []string{"", "global", "_org", "my-org"} {
+		if _, es := validateVarsPrefix(prefix, "vars_prefix"); len(es) != 0 {
+			t.Fatalf("%q: unexpected errors: %v", prefix, es)
+		}
+	}
+	for _, prefix := range []string{"global.env", "1st", "a b"} {
+		if _, es := validateVarsPrefix(prefix, "vars_prefix"); len(es) == 0 {
+			t.Fatalf("%q: expected an error", prefix)
+		}
+	}
+}
+
+func TestProviderVars(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: `
+				provider "template" {
+					vars = {
+						env    = "prod"
+						region = "pek3"
+					}
+				}
+				data "template_file" "t0" {
+					template = "$${env}-$${region}"
+					vars     = { region = "sh1" }
+				}
+				output "rendered" {
+					value = "${data.template_file.t0.rendered}"
+				}`,
+				Check: testProviderVarsRendered("prod-sh1"),
+			},
+			r.TestStep{
+				Config: `
+				provider "template" {
+					vars        = { env = "prod" }
+					vars_prefix = "global"
+				}
+				data "template_file" "t0" {
+					template = "$${global.env}-$${env}"
+					vars     = { env = "dev" }
+				}
+				output "rendered" {
+					value = "${data.template_file.t0.rendered}"
+				}`,
+				Check: testProviderVarsRendered("prod-dev"),
+			},
+			r.TestStep{
+				Config: `
+				provider "template" {
+					vars        = { env = "prod" }
+					vars_prefix = "global"
+				}
+				data "template_file" "t0" {
+					template = "$${global.env}"
+					vars     = { global.env = "dev" }
+				}`,
+				ExpectError: regexp.MustCompile(`variable "global.env" conflicts with the provider vars_prefix "global"`),
+			},
+		},
+	})
+}
+
+func testProviderVarsRendered(want string) r.TestCheckFunc {
+	return func(s *terraform.State) error {
+		got := s.RootModule().Outputs["rendered"]
+		if got.Value != want {
+			return fmt.Errorf("expected %q, got %q", want, got.Value)
+		}
+		return nil
+	}
+}
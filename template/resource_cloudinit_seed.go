@@ -0,0 +1,227 @@
+package template
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// seedLabel is the volume label cloud-init's NoCloud datasource looks for.
+const seedLabel = "cidata"
+
+func resourceCloudinitSeed() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceCloudinitSeedCreate,
+		Read:   resourceCloudinitSeedRead,
+		Delete: resourceCloudinitSeedDelete,
+
+		Schema: map[string]*schema.Schema{
+			"user_data": {
+				Type:          schema.TypeString,
+				Description:   "Contents of the user-data file",
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"user_data_base64"},
+			},
+			"user_data_base64": {
+				Type:          schema.TypeString,
+				Description:   "Base64-encoded contents of the user-data file, such as the rendered output of template_cloudinit_config",
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"user_data"},
+			},
+			"meta_data": {
+				Type:          schema.TypeString,
+				Description:   "Contents of the meta-data file",
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"instance_id", "hostname"},
+			},
+			"instance_id": {
+				Type:        schema.TypeString,
+				Description: "Instance ID written to the generated meta-data file",
+				Optional:    true,
+				ForceNew:    true,
+			},
+			"hostname": {
+				Type:        schema.TypeString,
+				Description: "Hostname written to the generated meta-data file",
+				Optional:    true,
+				ForceNew:    true,
+			},
+			"network_config": {
+				Type:        schema.TypeString,
+				Description: "Contents of the network-config file",
+				Optional:    true,
+				ForceNew:    true,
+			},
+			"format": {
+				Type:         schema.TypeString,
+				Description:  "Either iso or dir",
+				Optional:     true,
+				Default:      "iso",
+				ForceNew:     true,
+				ValidateFunc: validateSeedFormat,
+			},
+			"destination": {
+				Type:        schema.TypeString,
+				Description: "Path of the ISO image or directory to write the seed to",
+				Required:    true,
+				ForceNew:    true,
+			},
+		},
+	}
+}
+
+func resourceCloudinitSeedRead(d *schema.ResourceData, meta interface{}) error {
+	destination := d.Get("destination").(string)
+
+	// If the output doesn't exist, mark the resource for creation.
+	if _, err := os.Stat(destination); os.IsNotExist(err) {
+		d.SetId("")
+		return nil
+	}
+
+	// If the output was modified since it was written, mark the resource for
+	// re-creation.
+	hash, err := generateSeedID(d.Get("format").(string), destination)
+	if err != nil {
+		return err
+	}
+	if hash != d.Id() {
+		d.SetId("")
+		return nil
+	}
+
+	return nil
+}
+
+func resourceCloudinitSeedCreate(d *schema.ResourceData, meta interface{}) error {
+	format := d.Get("format").(string)
+	destination := d.Get("destination").(string)
+
+	files, err := seedFiles(d)
+	if err != nil {
+		return err
+	}
+
+	// Always delete the output first, so that a directory doesn't keep a
+	// network-config file that is no longer declared.
+	if err := resourceCloudinitSeedDelete(d, meta); err != nil {
+		return err
+	}
+
+	switch format {
+	case "dir":
+		if err := os.MkdirAll(destination, 0777); err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err := ioutil.WriteFile(filepath.Join(destination, f.Name), f.Content, 0644); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := os.MkdirAll(filepath.Dir(destination), 0777); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(destination, writeISO9660(seedLabel, files), 0644); err != nil {
+			return err
+		}
+	}
+
+	hash, err := generateSeedID(format, destination)
+	if err != nil {
+		return err
+	}
+	d.SetId(hash)
+
+	return nil
+}
+
+func resourceCloudinitSeedDelete(d *schema.ResourceData, _ interface{}) error {
+	d.SetId("")
+
+	destination := d.Get("destination").(string)
+	if _, err := os.Stat(destination); os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := os.RemoveAll(destination); err != nil {
+		return fmt.Errorf("could not delete %q: %s", destination, err)
+	}
+
+	return nil
+}
+
+// seedFiles returns the files of the NoCloud seed described by d.
+func seedFiles(d *schema.ResourceData) ([]isoFile, error) {
+	userData, err := seedUserData(d.Get("user_data").(string), d.Get("user_data_base64").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	metaData := d.Get("meta_data").(string)
+	if metaData == "" {
+		instanceID := d.Get("instance_id").(string)
+		if instanceID == "" {
+			instanceID = "iid-" + hash(string(userData))[:16]
+		}
+		metaData = fmt.Sprintf("instance-id: %s\n", instanceID)
+		if hostname := d.Get("hostname").(string); hostname != "" {
+			metaData += fmt.Sprintf("local-hostname: %s\n", hostname)
+		}
+	}
+
+	files := []isoFile{
+		{Name: "user-data", Content: userData},
+		{Name: "meta-data", Content: []byte(metaData)},
+	}
+	if networkConfig := d.Get("network_config").(string); networkConfig != "" {
+		files = append(files, isoFile{Name: "network-config", Content: []byte(networkConfig)})
+	}
+	return files, nil
+}
+
+// seedUserData returns the contents of the user-data file. NoCloud reads it
+// verbatim, so base64-encoded user data is decoded first. Gzipped user data
+// is kept as is since cloud-init decompresses it itself.
+func seedUserData(userData, userDataBase64 string) ([]byte, error) {
+	if userDataBase64 != "" {
+		decoded, err := base64.StdEncoding.DecodeString(userDataBase64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode user_data_base64: %s", err)
+		}
+		return decoded, nil
+	}
+	if userData == "" {
+		return nil, fmt.Errorf("one of user_data or user_data_base64 must be set")
+	}
+	return []byte(userData), nil
+}
+
+// generateSeedID hashes the seed written at destination.
+func generateSeedID(format, destination string) (string, error) {
+	if format != "dir" {
+		data, err := ioutil.ReadFile(destination)
+		if err != nil {
+			return "", err
+		}
+		return hash(string(data)), nil
+	}
+
+	return generateDirHash(destination)
+}
+
+func validateSeedFormat(v interface{}, key string) (ws []string, es []error) {
+	switch v.(string) {
+	case "iso", "dir":
+	default:
+		es = append(es, fmt.Errorf("%s: must be one of iso or dir, got %q", key, v.(string)))
+	}
+	return
+}
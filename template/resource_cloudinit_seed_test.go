@@ -0,0 +1,168 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	r "github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestCloudinitSeed_dir(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "terraform_cloudinit_seed")
+	if err != nil {
+		t.Skipf("could not create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "seed")
+
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			{
+				Config: fmt.Sprintf(testCloudinitSeedConfig_dir, out),
+				Check: func(s *terraform.State) error {
+					want := map[string]string{
+						"user-data":      "#cloud-config\nhostname: foo\n",
+						"meta-data":      "instance-id: i-1\nlocal-hostname: foo\n",
+						"network-config": "version: 2\n",
+					}
+					for name, content := range want {
+						got, err := ioutil.ReadFile(filepath.Join(out, name))
+						if err != nil {
+							return err
+						}
+						if string(got) != content {
+							return fmt.Errorf("%s: expected %q, got %q", name, content, got)
+						}
+					}
+					return nil
+				},
+			},
+		},
+		CheckDestroy: func(*terraform.State) error {
+			if _, err := os.Stat(out); os.IsNotExist(err) {
+				return nil
+			}
+			return errors.New("template_cloudinit_seed did not get destroyed")
+		},
+	})
+}
+
+func TestCloudinitSeed_iso(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "terraform_cloudinit_seed")
+	if err != nil {
+		t.Skipf("could not create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "seed.iso")
+
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			{
+				Config: fmt.Sprintf(testCloudinitSeedConfig_iso, out),
+				Check: func(s *terraform.State) error {
+					image, err := ioutil.ReadFile(out)
+					if err != nil {
+						return err
+					}
+
+					files := readISORoot(t, image, image[17*isoSectorSize:], decodeUCS2)
+					userData, err := decodeCloudinitConfig(string(files["user-data;1"]))
+					if err != nil {
+						return err
+					}
+					if !userData.Gzip || userData.Base64 {
+						return fmt.Errorf("expected gzipped user-data without base64, got %#v", userData)
+					}
+					if len(userData.Parts) != 1 || userData.Parts[0].Content != "hostname: foo\n" {
+						return fmt.Errorf("unexpected user-data parts: %#v", userData.Parts)
+					}
+					if _, ok := files["network-config;1"]; ok {
+						return errors.New("expected no network-config file")
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+func TestSeedUserData(t *testing.T) {
+	cases := map[string]struct {
+		UserData       string
+		UserDataBase64 string
+		Expected       string
+		ExpectErr      string
+	}{
+		"plain text": {
+			UserData: "#!/bin/sh\n",
+			Expected: "#!/bin/sh\n",
+		},
+		"base64 looking text is kept": {
+			UserData: "abcd",
+			Expected: "abcd",
+		},
+		"base64 MIME document": {
+			UserDataBase64: "Q29udGVudC1UeXBlOiBtdWx0aXBhcnQvbWl4ZWQ=",
+			Expected:       "Content-Type: multipart/mixed",
+		},
+		"invalid base64": {
+			UserDataBase64: "#!/bin/sh",
+			ExpectErr:      "failed to decode user_data_base64",
+		},
+		"no user data": {
+			ExpectErr: "one of user_data or user_data_base64 must be set",
+		},
+	}
+
+	for tn, tc := range cases {
+		got, err := seedUserData(tc.UserData, tc.UserDataBase64)
+		if err != nil {
+			if tc.ExpectErr == "" {
+				t.Fatalf("%s: err: %s", tn, err)
+			}
+			if !strings.Contains(err.Error(), tc.ExpectErr) {
+				t.Fatalf("%s: expected\n%s\nto contain\n%s", tn, err, tc.ExpectErr)
+			}
+			continue
+		}
+		if tc.ExpectErr != "" {
+			t.Fatalf("%s: expected err containing %q, got none!", tn, tc.ExpectErr)
+		}
+		if string(got) != tc.Expected {
+			t.Fatalf("%s: expected %q, got %q", tn, tc.Expected, got)
+		}
+	}
+}
+
+const testCloudinitSeedConfig_dir = `
+resource "template_cloudinit_seed" "seed" {
+  user_data      = "#cloud-config\nhostname: foo\n"
+  instance_id    = "i-1"
+  hostname       = "foo"
+  network_config = "version: 2\n"
+  format         = "dir"
+  destination    = "%s"
+}
+`
+
+const testCloudinitSeedConfig_iso = `
+data "template_cloudinit_config" "config" {
+  part {
+    content_type = "text/cloud-config"
+    content      = "hostname: foo\n"
+  }
+}
+
+resource "template_cloudinit_seed" "seed" {
+  user_data_base64 = "${data.template_cloudinit_config.config.rendered}"
+  destination      = "%s"
+}
+`
@@ -12,7 +12,6 @@ import (
 	"path"
 	"path/filepath"
 
-	"github.com/hashicorp/terraform/helper/pathorcontents"
 	"github.com/hashicorp/terraform/helper/schema"
 )
 
@@ -37,6 +36,20 @@ func resourceDir() *schema.Resource {
 				ValidateFunc: validateVarsAttribute,
 				ForceNew:     true,
 			},
+			"allowed_functions": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "Interpolation functions the templates may call, all if unset",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				ForceNew:    true,
+			},
+			"deny_nondeterministic": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Whether to deny functions such as timestamp() and uuid()",
+				ForceNew:    true,
+			},
 			"destination_dir": {
 				Type:        schema.TypeString,
 				Description: "Path to the directory where the templated files will be written",
@@ -48,7 +61,10 @@ func resourceDir() *schema.Resource {
 }
 
 func resourceTemplateDirRead(d *schema.ResourceData, meta interface{}) error {
-	sourceDir := d.Get("source_dir").(string)
+	sourceDir, err := providerConfigFromMeta(meta).resolvePath(d.Get("source_dir").(string))
+	if err != nil {
+		return err
+	}
 	destinationDir := d.Get("destination_dir").(string)
 
 	// If the output doesn't exist, mark the resource for creation.
@@ -77,9 +93,14 @@ func resourceTemplateDirRead(d *schema.ResourceData, meta interface{}) error {
 }
 
 func resourceTemplateDirCreate(d *schema.ResourceData, meta interface{}) error {
-	sourceDir := d.Get("source_dir").(string)
 	destinationDir := d.Get("destination_dir").(string)
 	vars := d.Get("vars").(map[string]interface{})
+	provider := providerConfigFromMeta(meta).forResource(d)
+
+	sourceDir, err := provider.resolvePath(d.Get("source_dir").(string))
+	if err != nil {
+		return err
+	}
 
 	// Always delete the output first, otherwise files that got deleted from the
 	// input directory might still be present in the output afterwards.
@@ -95,20 +116,7 @@ func resourceTemplateDirCreate(d *schema.ResourceData, meta interface{}) error {
 		}
 	}
 
-	// Recursively crawl the input files/directories and generate the output ones.
-	err := filepath.Walk(sourceDir, func(p string, f os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if f.IsDir() {
-			return nil
-		}
-
-		relPath, _ := filepath.Rel(sourceDir, p)
-		return generateDirFile(p, path.Join(destinationDir, relPath), f, vars)
-	})
-	if err != nil {
+	if err := renderDir(sourceDir, destinationDir, vars, provider); err != nil {
 		return err
 	}
 
@@ -137,13 +145,30 @@ func resourceTemplateDirDelete(d *schema.ResourceData, _ interface{}) error {
 	return nil
 }
 
-func generateDirFile(sourceDir, destinationDir string, f os.FileInfo, vars map[string]interface{}) error {
-	inputContent, _, err := pathorcontents.Read(sourceDir)
+// renderDir recursively crawls the input files/directories of sourceDir and
+// generates the output ones in destinationDir.
+func renderDir(sourceDir, destinationDir string, vars map[string]interface{}, provider *providerConfig) error {
+	return filepath.Walk(sourceDir, func(p string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if f.IsDir() {
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(sourceDir, p)
+		return generateDirFile(p, path.Join(destinationDir, relPath), f, vars, provider)
+	})
+}
+
+func generateDirFile(sourceDir, destinationDir string, f os.FileInfo, vars map[string]interface{}, provider *providerConfig) error {
+	inputContent, err := provider.readFile(sourceDir)
 	if err != nil {
 		return err
 	}
 
-	outputContent, err := execute(inputContent, vars)
+	outputContent, err := execute(inputContent, vars, provider)
 	if err != nil {
 		return templateRenderError(fmt.Errorf("failed to render %v: %v", sourceDir, err))
 	}
@@ -0,0 +1,129 @@
+package template
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hil/ast"
+	"github.com/hashicorp/terraform/helper/pathorcontents"
+	"github.com/mitchellh/go-homedir"
+)
+
+// configureSandbox sets the directories templates may read files from. The
+// roots are resolved once, so that later reads compare real paths. Without
+// allowedPaths, reads are restricted to baseDir. Without either, reads are
+// not restricted at all.
+func (c *providerConfig) configureSandbox(baseDir string, allowedPaths []string) error {
+	if baseDir != "" {
+		resolved, err := resolveRealPath(baseDir, "")
+		if err != nil {
+			return fmt.Errorf("base_dir: %s", err)
+		}
+		c.BaseDir = resolved
+	}
+
+	if len(allowedPaths) == 0 && c.BaseDir != "" {
+		c.AllowedPaths = []string{c.BaseDir}
+	}
+	for _, p := range allowedPaths {
+		resolved, err := resolveRealPath(p, c.BaseDir)
+		if err != nil {
+			return fmt.Errorf("allowed_paths: %s", err)
+		}
+		c.AllowedPaths = append(c.AllowedPaths, resolved)
+	}
+	return nil
+}
+
+// sandboxed reports whether file reads are restricted.
+func (c *providerConfig) sandboxed() bool {
+	return c != nil && len(c.AllowedPaths) > 0
+}
+
+// resolvePath returns the real path of p, relative paths being resolved
+// against the base directory. It errors if the sandbox is enabled and p,
+// once ".." elements and symlinks are resolved, is outside of all the
+// allowed paths. Without a sandbox, p is returned unchanged.
+func (c *providerConfig) resolvePath(p string) (string, error) {
+	if !c.sandboxed() {
+		return p, nil
+	}
+
+	resolved, err := resolveRealPath(p, c.BaseDir)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range c.AllowedPaths {
+		if isWithin(root, resolved) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("path %q resolves to %q, outside of the allowed paths", p, resolved)
+}
+
+// readFile reads the template file at p. Without a sandbox, p is read as
+// template_file has always read its filename, so a path that doesn't exist
+// is returned as the contents themselves.
+func (c *providerConfig) readFile(p string) (string, error) {
+	if !c.sandboxed() {
+		contents, _, err := pathorcontents.Read(p)
+		return contents, err
+	}
+
+	resolved, err := c.resolvePath(p)
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(resolved)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// fileFunc returns a replacement for the file() interpolation function that
+// only reads files within the sandbox.
+func (c *providerConfig) fileFunc() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			return c.readFile(args[0].(string))
+		},
+	}
+}
+
+// resolveRealPath expands p, makes it absolute against base, or the working
+// directory if base is empty, and resolves symlinks.
+func resolveRealPath(p, base string) (string, error) {
+	expanded, err := homedir.Expand(p)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(expanded) {
+		if base == "" {
+			if base, err = os.Getwd(); err != nil {
+				return "", err
+			}
+		}
+		expanded = filepath.Join(base, expanded)
+	}
+
+	resolved, err := filepath.EvalSymlinks(expanded)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve %q: %s", p, err)
+	}
+	return filepath.Abs(resolved)
+}
+
+// isWithin reports whether the clean absolute path p is root or inside it.
+func isWithin(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,199 @@
+package template
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	r "github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// testSandboxDirs creates a base directory holding a template and a symlink
+// to a file in a sibling directory, and returns both directories.
+func testSandboxDirs(t *testing.T) (string, string, func()) {
+	root, err := ioutil.TempDir(os.TempDir(), "terraform_template_sandbox")
+	if err != nil {
+		t.Skipf("could not create temporary directory: %s", err)
+	}
+	root, _ = filepath.EvalSymlinks(root)
+
+	base := filepath.Join(root, "base")
+	other := filepath.Join(root, "other")
+	files := map[string]string{
+		filepath.Join(base, "tpl", "hello.tpl"): "hello $${name}",
+		filepath.Join(other, "secret.txt"):      "secret",
+	}
+	for p, content := range files {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(strings.Replace(content, "$$", "$", -1)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(other, "secret.txt"), filepath.Join(base, "link.txt")); err != nil {
+		t.Skipf("could not create symlink: %s", err)
+	}
+
+	return base, other, func() { os.RemoveAll(root) }
+}
+
+func TestProviderConfigResolvePath(t *testing.T) {
+	base, other, cleanup := testSandboxDirs(t)
+	defer cleanup()
+
+	cases := map[string]struct {
+		AllowedPaths []string
+		Path         string
+		Expected     string
+		ExpectErr    string
+	}{
+		"relative": {
+			Path:     "tpl/hello.tpl",
+			Expected: filepath.Join(base, "tpl", "hello.tpl"),
+		},
+		"absolute": {
+			Path:     filepath.Join(base, "tpl", "hello.tpl"),
+			Expected: filepath.Join(base, "tpl", "hello.tpl"),
+		},
+		"dot dot within": {
+			Path:     "tpl/../tpl/hello.tpl",
+			Expected: filepath.Join(base, "tpl", "hello.tpl"),
+		},
+		"dot dot escape": {
+			Path:      "../other/secret.txt",
+			ExpectErr: "outside of the allowed paths",
+		},
+		"symlink escape": {
+			Path:      "link.txt",
+			ExpectErr: fmt.Sprintf("resolves to %q, outside of the allowed paths", filepath.Join(other, "secret.txt")),
+		},
+		"symlink to allowed path": {
+			AllowedPaths: []string{".", "../other"},
+			Path:         "link.txt",
+			Expected:     filepath.Join(other, "secret.txt"),
+		},
+		"allowed paths replace base dir": {
+			AllowedPaths: []string{"tpl"},
+			Path:         "link.txt",
+			ExpectErr:    "outside of the allowed paths",
+		},
+		"missing": {
+			Path:      "nope.tpl",
+			ExpectErr: `could not resolve "nope.tpl"`,
+		},
+	}
+
+	for tn, tc := range cases {
+		config := &providerConfig{}
+		if err := config.configureSandbox(base, tc.AllowedPaths); err != nil {
+			t.Fatalf("%s: %s", tn, err)
+		}
+
+		got, err := config.resolvePath(tc.Path)
+		if tc.ExpectErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.ExpectErr) {
+				t.Fatalf("%s: expected error %q, got %v", tn, tc.ExpectErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tn, err)
+		}
+		if got != tc.Expected {
+			t.Fatalf("%s: expected %q, got %q", tn, tc.Expected, got)
+		}
+	}
+}
+
+func TestProviderConfigUnsandboxed(t *testing.T) {
+	var config *providerConfig
+	if got, err := config.resolvePath("../anything"); err != nil || got != "../anything" {
+		t.Fatalf("expected the path unchanged, got %q, %v", got, err)
+	}
+	// Like pathorcontents, a path that doesn't exist is its own contents.
+	if got, err := config.readFile("not a path"); err != nil || got != "not a path" {
+		t.Fatalf("expected the contents unchanged, got %q, %v", got, err)
+	}
+}
+
+func TestExecuteSandboxedFile(t *testing.T) {
+	base, _, cleanup := testSandboxDirs(t)
+	defer cleanup()
+
+	config := &providerConfig{}
+	if err := config.configureSandbox(base, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := execute(`${file("tpl/hello.tpl")}`, map[string]interface{}{}, config)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got != "hello ${name}" {
+		t.Fatalf("unexpected output %q", got)
+	}
+
+	_, err = execute(`${file("link.txt")}`, map[string]interface{}{}, config)
+	if err == nil || !strings.Contains(err.Error(), "outside of the allowed paths") {
+		t.Fatalf("expected the symlink to be rejected, got %v", err)
+	}
+}
+
+func TestTemplateSandbox(t *testing.T) {
+	base, _, cleanup := testSandboxDirs(t)
+	defer cleanup()
+	out := filepath.Join(filepath.Dir(base), "out")
+
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: fmt.Sprintf(`
+				provider "template" {
+					base_dir = "%s"
+				}
+				data "template_file" "t0" {
+					filename = "tpl/hello.tpl"
+					vars     = { name = "world" }
+				}
+				resource "template_dir" "d0" {
+					source_dir      = "tpl"
+					destination_dir = "%s"
+					vars            = { name = "dir" }
+				}
+				output "rendered" {
+					value = "${data.template_file.t0.rendered}"
+				}`, base, out),
+				Check: func(s *terraform.State) error {
+					if got := s.RootModule().Outputs["rendered"].Value; got != "hello world" {
+						return fmt.Errorf("unexpected template_file output %q", got)
+					}
+					got, err := ioutil.ReadFile(filepath.Join(out, "hello.tpl"))
+					if err != nil {
+						return err
+					}
+					if string(got) != "hello dir" {
+						return fmt.Errorf("unexpected template_dir output %q", got)
+					}
+					return nil
+				},
+			},
+			r.TestStep{
+				Config: fmt.Sprintf(`
+				provider "template" {
+					base_dir = "%s"
+				}
+				data "template_file" "t0" {
+					template = "$${file("../other/secret.txt")}"
+				}`, base),
+				ExpectError: regexp.MustCompile(`outside of the allowed paths`),
+			},
+		},
+	})
+}
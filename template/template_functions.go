@@ -0,0 +1,143 @@
+package template
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hil/ast"
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// nondeterministicFuncs are the interpolation functions whose result depends
+// on the time, on randomness or on the machine running Terraform, so that a
+// template calling them renders differently from one plan to the next.
+var nondeterministicFuncs = map[string]bool{
+	"bcrypt":     true,
+	"file":       true,
+	"pathexpand": true,
+	"timestamp":  true,
+	"uuid":       true,
+}
+
+// functionPolicy restricts the interpolation functions a template may call.
+// The zero value allows every function.
+type functionPolicy struct {
+	// Allowed lists the only functions templates may call. A nil list
+	// allows every function.
+	Allowed []string
+
+	DenyNondeterministic bool
+}
+
+// functionPolicyFromData reads the allowed_functions and
+// deny_nondeterministic attributes of a provider, data source or resource.
+func functionPolicyFromData(d *schema.ResourceData) functionPolicy {
+	policy := functionPolicy{
+		DenyNondeterministic: d.Get("deny_nondeterministic").(bool),
+	}
+	if v, ok := d.GetOk("allowed_functions"); ok {
+		policy.Allowed = stringList(v)
+	}
+	return policy
+}
+
+// restrict returns a policy that only allows the functions allowed by both
+// p and other.
+func (p functionPolicy) restrict(other functionPolicy) functionPolicy {
+	result := functionPolicy{
+		Allowed:              p.Allowed,
+		DenyNondeterministic: p.DenyNondeterministic || other.DenyNondeterministic,
+	}
+	switch {
+	case p.Allowed == nil:
+		result.Allowed = other.Allowed
+	case other.Allowed != nil:
+		result.Allowed = []string{}
+		for _, name := range p.Allowed {
+			if containsString(other.Allowed, name) {
+				result.Allowed = append(result.Allowed, name)
+			}
+		}
+	}
+	return result
+}
+
+// allows reports whether the policy lets templates call name, and why not.
+func (p functionPolicy) allows(name string) (bool, string) {
+	if p.Allowed != nil && !containsString(p.Allowed, name) {
+		return false, "is not in allowed_functions"
+	}
+	if p.DenyNondeterministic && nondeterministicFuncs[name] {
+		return false, "is nondeterministic and deny_nondeterministic is set"
+	}
+	return true, ""
+}
+
+// funcMap returns the built-in and user interpolation functions the policy
+// allows.
+func (p functionPolicy) funcMap(user map[string]*userFunction) (map[string]ast.Function, error) {
+	funcs := config.Funcs()
+
+	var unknown []string
+	for _, name := range p.Allowed {
+		if _, ok := funcs[name]; !ok && user[name] == nil {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("allowed_functions: unknown functions: %s", strings.Join(unknown, ", "))
+	}
+
+	for name := range funcs {
+		if ok, _ := p.allows(name); !ok {
+			delete(funcs, name)
+		}
+	}
+	for name, f := range user {
+		if ok, _ := p.allows(name); ok {
+			funcs[name] = f.function(funcs)
+		}
+	}
+	return funcs, nil
+}
+
+// checkCalls returns an error naming the first function call in root that
+// the policy doesn't allow, along with its position in the template. Calls
+// to user functions are allowed only if their body is. Unknown functions are
+// left for evaluation to report.
+func (p functionPolicy) checkCalls(root ast.Node, user map[string]*userFunction) error {
+	var blocked *ast.Call
+	var blockedErr error
+	root.Accept(func(n ast.Node) ast.Node {
+		call, ok := n.(*ast.Call)
+		if !ok {
+			return n
+		}
+		// Calls are visited after their arguments, so keep the one that
+		// comes first in the template.
+		if blocked != nil && !posBefore(call.Pos(), blocked.Pos()) {
+			return n
+		}
+		if ok, reason := p.allows(call.Func); !ok {
+			blocked = call
+			blockedErr = fmt.Errorf("function %q at %s %s", call.Func, call.Pos(), reason)
+		} else if f := user[call.Func]; f != nil {
+			// readUserFunctions already rejected bodies that don't parse or
+			// recurse.
+			body, _ := f.parse()
+			if err := p.checkCalls(body, user); err != nil {
+				blocked = call
+				blockedErr = fmt.Errorf("function %q at %s: %s", call.Func, call.Pos(), err)
+			}
+		}
+		return n
+	})
+	return blockedErr
+}
+
+func posBefore(a, b ast.Pos) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
@@ -0,0 +1,136 @@
+package template
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	r "github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestFunctionPolicyRestrict(t *testing.T) {
+	cases := map[string]struct {
+		A, B     functionPolicy
+		Expected functionPolicy
+	}{
+		"unrestricted": {
+			functionPolicy{}, functionPolicy{}, functionPolicy{},
+		},
+		"inherits allowed": {
+			functionPolicy{Allowed: []string{"upper"}},
+			functionPolicy{},
+			functionPolicy{Allowed: []string{"upper"}},
+		},
+		"adds allowed": {
+			functionPolicy{},
+			functionPolicy{Allowed: []string{"upper"}},
+			functionPolicy{Allowed: []string{"upper"}},
+		},
+		"intersects allowed": {
+			functionPolicy{Allowed: []string{"lower", "upper"}},
+			functionPolicy{Allowed: []string{"upper", "uuid"}},
+			functionPolicy{Allowed: []string{"upper"}},
+		},
+		"disjoint allowed": {
+			functionPolicy{Allowed: []string{"lower"}},
+			functionPolicy{Allowed: []string{"upper"}},
+			functionPolicy{Allowed: []string{}},
+		},
+		"deny cannot be relaxed": {
+			functionPolicy{DenyNondeterministic: true},
+			functionPolicy{},
+			functionPolicy{DenyNondeterministic: true},
+		},
+	}
+
+	for tn, tc := range cases {
+		if got := tc.A.restrict(tc.B); !reflect.DeepEqual(got, tc.Expected) {
+			t.Fatalf("%s: expected %#v, got %#v", tn, tc.Expected, got)
+		}
+	}
+}
+
+func TestExecuteFunctionPolicy(t *testing.T) {
+	cases := map[string]struct {
+		Policy    functionPolicy
+		Template  string
+		Expected  string
+		ExpectErr string
+	}{
+		"allowed": {
+			Policy:   functionPolicy{Allowed: []string{"upper"}, DenyNondeterministic: true},
+			Template: `${upper("a")}`,
+			Expected: "A",
+		},
+		"not in allowed_functions": {
+			Policy:    functionPolicy{Allowed: []string{"upper"}},
+			Template:  `${upper(lower("A"))}`,
+			ExpectErr: `function "lower" at 1:9 is not in allowed_functions`,
+		},
+		"nondeterministic": {
+			Policy:    functionPolicy{DenyNondeterministic: true},
+			Template:  "a\n${upper(\"b\")} ${timestamp()}",
+			ExpectErr: `function "timestamp" at 2:17 is nondeterministic and deny_nondeterministic is set`,
+		},
+		"first blocked call is reported": {
+			Policy:    functionPolicy{DenyNondeterministic: true},
+			Template:  `${bcrypt(uuid())}`,
+			ExpectErr: `function "bcrypt" at 1:3 is nondeterministic`,
+		},
+		"unknown allowed function": {
+			Policy:    functionPolicy{Allowed: []string{"upper", "nope"}},
+			Template:  `${upper("a")}`,
+			ExpectErr: "allowed_functions: unknown functions: nope",
+		},
+	}
+
+	for tn, tc := range cases {
+		got, err := execute(tc.Template, map[string]interface{}{}, &providerConfig{Functions: tc.Policy})
+		if tc.ExpectErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.ExpectErr) {
+				t.Fatalf("%s: expected error %q, got %v", tn, tc.ExpectErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tn, err)
+		}
+		if got != tc.Expected {
+			t.Fatalf("%s: expected %q, got %q", tn, tc.Expected, got)
+		}
+	}
+}
+
+func TestTemplateDenyNondeterministic(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: `
+				provider "template" {
+					allowed_functions = ["upper", "uuid"]
+				}
+				data "template_file" "t0" {
+					template              = "$${upper(uuid())}"
+					deny_nondeterministic = true
+				}`,
+				ExpectError: regexp.MustCompile(`function "uuid" at 1:9 is nondeterministic and deny_nondeterministic is set`),
+			},
+			r.TestStep{
+				Config: `
+				provider "template" {
+					deny_nondeterministic = true
+				}
+				data "template_cloudinit_config" "config" {
+					gzip          = false
+					base64_encode = false
+					part {
+						template = "$${timestamp()}"
+					}
+				}`,
+				ExpectError: regexp.MustCompile(`part 0: failed to render template: function "timestamp" at 1:3 is nondeterministic`),
+			},
+		},
+	})
+}
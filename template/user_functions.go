@@ -0,0 +1,262 @@
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/hil"
+	"github.com/hashicorp/hil/ast"
+	"github.com/hashicorp/terraform/config"
+)
+
+// userFunction is a function declared in a function block of the provider.
+// Its body is a HIL expression over its parameters that evaluates to a
+// string.
+type userFunction struct {
+	Name   string
+	Params []userFunctionParam
+	Body   string
+}
+
+type userFunctionParam struct {
+	Name string
+	Type ast.Type
+}
+
+// userFunctionParamTypes are the types a parameter may declare with a
+// "name:type" suffix. Parameters are strings by default.
+var userFunctionParamTypes = map[string]ast.Type{
+	"string": ast.TypeString,
+	"int":    ast.TypeInt,
+	"float":  ast.TypeFloat,
+	"bool":   ast.TypeBool,
+}
+
+// hilImplicitConversions are the implicit conversions hil.Eval applies,
+// used to type check bodies the same way they will be evaluated.
+var hilImplicitConversions = map[ast.Type]map[ast.Type]string{
+	ast.TypeFloat: {
+		ast.TypeInt:    "__builtin_FloatToInt",
+		ast.TypeString: "__builtin_FloatToString",
+	},
+	ast.TypeInt: {
+		ast.TypeFloat:  "__builtin_IntToFloat",
+		ast.TypeString: "__builtin_IntToString",
+	},
+	ast.TypeString: {
+		ast.TypeInt:   "__builtin_StringToInt",
+		ast.TypeFloat: "__builtin_StringToFloat",
+		ast.TypeBool:  "__builtin_StringToBool",
+	},
+	ast.TypeBool: {
+		ast.TypeString: "__builtin_BoolToString",
+	},
+}
+
+var userFunctionNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// readUserFunctions reads the function blocks of the provider and checks
+// that they don't recurse and that their bodies type check.
+func readUserFunctions(raw []interface{}) (map[string]*userFunction, error) {
+	builtins := config.Funcs()
+	functions := make(map[string]*userFunction, len(raw))
+	order := make([]string, 0, len(raw))
+
+	for i, v := range raw {
+		m := v.(map[string]interface{})
+		f := &userFunction{
+			Name: m["name"].(string),
+			Body: m["body"].(string),
+		}
+
+		switch {
+		case !userFunctionNamePattern.MatchString(f.Name):
+			return nil, fmt.Errorf("function.%d: invalid name %q", i, f.Name)
+		case isBuiltin(builtins, f.Name):
+			return nil, fmt.Errorf("function.%d: %q is a built-in function", i, f.Name)
+		case functions[f.Name] != nil:
+			return nil, fmt.Errorf("function.%d: %q is already declared", i, f.Name)
+		}
+
+		params, _ := m["params"].([]interface{})
+		for _, p := range params {
+			param, err := parseUserFunctionParam(p.(string))
+			if err != nil {
+				return nil, fmt.Errorf("function %q: %s", f.Name, err)
+			}
+			for _, other := range f.Params {
+				if other.Name == param.Name {
+					return nil, fmt.Errorf("function %q: duplicate parameter %q", f.Name, param.Name)
+				}
+			}
+			f.Params = append(f.Params, param)
+		}
+
+		functions[f.Name] = f
+		order = append(order, f.Name)
+	}
+
+	// Check the functions a body calls before the body itself, so that the
+	// signatures of user functions are known when it is type checked.
+	checked := map[string]ast.Function{}
+	visiting := map[string]bool{}
+	var check func(name string, path []string) error
+	check = func(name string, path []string) error {
+		if _, ok := checked[name]; ok {
+			return nil
+		}
+		path = append(path, name)
+		if visiting[name] {
+			return fmt.Errorf("function %q is recursive: %s", name, strings.Join(path, " -> "))
+		}
+		visiting[name] = true
+
+		f := functions[name]
+		root, err := f.parse()
+		if err != nil {
+			return fmt.Errorf("function %q: %s", name, err)
+		}
+		for _, callee := range calledFunctions(root) {
+			if _, ok := functions[callee]; ok {
+				if err := check(callee, path); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := f.typeCheck(root, builtins, checked); err != nil {
+			return fmt.Errorf("function %q: %s", name, err)
+		}
+		checked[name] = f.signature()
+		return nil
+	}
+	for _, name := range order {
+		if err := check(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return functions, nil
+}
+
+func parseUserFunctionParam(s string) (userFunctionParam, error) {
+	param := userFunctionParam{Name: s, Type: ast.TypeString}
+	if i := strings.Index(s, ":"); i >= 0 {
+		t, ok := userFunctionParamTypes[s[i+1:]]
+		if !ok {
+			return param, fmt.Errorf("parameter %q: type must be one of string, int, float or bool", s)
+		}
+		param.Name, param.Type = s[:i], t
+	}
+	if !userFunctionNamePattern.MatchString(param.Name) {
+		return param, fmt.Errorf("invalid parameter name %q", param.Name)
+	}
+	return param, nil
+}
+
+// parse parses the body. Positions in the result are relative to the body,
+// not to the "${" wrapping it.
+func (f *userFunction) parse() (ast.Node, error) {
+	return hil.ParseWithPosition("${"+f.Body+"}", ast.Pos{Line: 1, Column: -1})
+}
+
+// typeCheck checks the body parsed in root against the parameter types and
+// the signatures of the built-in and user functions, and that it evaluates
+// to a string.
+func (f *userFunction) typeCheck(root ast.Node, builtins, user map[string]ast.Function) error {
+	scope := &ast.BasicScope{
+		VarMap:  make(map[string]ast.Variable, len(f.Params)),
+		FuncMap: make(map[string]ast.Function, len(builtins)+len(user)),
+	}
+	for _, p := range f.Params {
+		scope.VarMap[p.Name] = ast.Variable{Type: p.Type}
+	}
+	for name, fn := range builtins {
+		scope.FuncMap[name] = fn
+	}
+	for name, fn := range user {
+		scope.FuncMap[name] = fn
+	}
+	for _, conversions := range hilImplicitConversions {
+		for to, name := range conversions {
+			scope.FuncMap[name] = ast.Function{ReturnType: to}
+		}
+	}
+
+	if err := (&hil.IdentifierCheck{Scope: scope}).Visit(root); err != nil {
+		return err
+	}
+	if err := (&hil.TypeCheck{Scope: scope, Implicit: hilImplicitConversions}).Visit(root); err != nil {
+		return err
+	}
+	t, err := root.Type(scope)
+	if err != nil {
+		return err
+	}
+	if t != ast.TypeString {
+		return fmt.Errorf("body must evaluate to a string, got %s", t.Printable())
+	}
+	return nil
+}
+
+func (f *userFunction) signature() ast.Function {
+	argTypes := make([]ast.Type, len(f.Params))
+	for i, p := range f.Params {
+		argTypes[i] = p.Type
+	}
+	return ast.Function{
+		ArgTypes:   argTypes,
+		ReturnType: ast.TypeString,
+	}
+}
+
+// function returns the function to register in a FuncMap. The body may call
+// the functions of funcs, usually the FuncMap it is registered in.
+func (f *userFunction) function(funcs map[string]ast.Function) ast.Function {
+	fn := f.signature()
+	fn.Callback = func(args []interface{}) (interface{}, error) {
+		// Evaluation rewrites the tree with implicit conversions, so each
+		// call gets its own to be safe for concurrent use.
+		root, err := f.parse()
+		if err != nil {
+			return nil, err
+		}
+
+		varmap := make(map[string]ast.Variable, len(f.Params))
+		for i, p := range f.Params {
+			varmap[p.Name] = ast.Variable{Type: p.Type, Value: args[i]}
+		}
+		result, err := hil.Eval(root, &hil.EvalConfig{
+			GlobalScope: &ast.BasicScope{
+				VarMap:  varmap,
+				FuncMap: funcs,
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f.Name, err)
+		}
+		if result.Type != hil.TypeString {
+			return nil, fmt.Errorf("%s: unexpected output hil.Type: %v", f.Name, result.Type)
+		}
+		return result.Value.(string), nil
+	}
+	return fn
+}
+
+func isBuiltin(builtins map[string]ast.Function, name string) bool {
+	_, ok := builtins[name]
+	return ok
+}
+
+// calledFunctions returns the names of the functions called in root.
+func calledFunctions(root ast.Node) []string {
+	var names []string
+	root.Accept(func(n ast.Node) ast.Node {
+		if call, ok := n.(*ast.Call); ok {
+			names = append(names, call.Func)
+		}
+		return n
+	})
+	return names
+}
@@ -0,0 +1,217 @@
+package template
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	r "github.com/hashicorp/terraform/helper/resource"
+)
+
+func testUserFunctions(t *testing.T, functions ...map[string]interface{}) map[string]*userFunction {
+	raw := make([]interface{}, len(functions))
+	for i, f := range functions {
+		raw[i] = f
+	}
+	user, err := readUserFunctions(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return user
+}
+
+func TestReadUserFunctions(t *testing.T) {
+	cases := map[string]struct {
+		Functions []interface{}
+		ExpectErr string
+	}{
+		"valid": {
+			Functions: []interface{}{
+				map[string]interface{}{"name": "fqdn", "params": []interface{}{"host", "n:int"}, "body": `"${host}-${n}.${domain()}"`},
+				map[string]interface{}{"name": "domain", "body": `"example.com"`},
+			},
+		},
+		"invalid name": {
+			Functions: []interface{}{
+				map[string]interface{}{"name": "my-func", "body": `"a"`},
+			},
+			ExpectErr: `function.0: invalid name "my-func"`,
+		},
+		"built-in": {
+			Functions: []interface{}{
+				map[string]interface{}{"name": "upper", "body": `"a"`},
+			},
+			ExpectErr: `function.0: "upper" is a built-in function`,
+		},
+		"duplicate": {
+			Functions: []interface{}{
+				map[string]interface{}{"name": "a", "body": `"a"`},
+				map[string]interface{}{"name": "a", "body": `"b"`},
+			},
+			ExpectErr: `function.1: "a" is already declared`,
+		},
+		"bad parameter type": {
+			Functions: []interface{}{
+				map[string]interface{}{"name": "a", "params": []interface{}{"x:list"}, "body": `x`},
+			},
+			ExpectErr: `function "a": parameter "x:list": type must be one of string, int, float or bool`,
+		},
+		"duplicate parameter": {
+			Functions: []interface{}{
+				map[string]interface{}{"name": "a", "params": []interface{}{"x", "x:int"}, "body": `x`},
+			},
+			ExpectErr: `function "a": duplicate parameter "x"`,
+		},
+		"self recursion": {
+			Functions: []interface{}{
+				map[string]interface{}{"name": "a", "body": `a()`},
+			},
+			ExpectErr: `function "a" is recursive: a -> a`,
+		},
+		"mutual recursion": {
+			Functions: []interface{}{
+				map[string]interface{}{"name": "a", "body": `b()`},
+				map[string]interface{}{"name": "b", "body": `upper(a())`},
+			},
+			ExpectErr: `function "a" is recursive: a -> b -> a`,
+		},
+		"unknown variable": {
+			Functions: []interface{}{
+				map[string]interface{}{"name": "a", "params": []interface{}{"x"}, "body": `y`},
+			},
+			ExpectErr: `function "a": `,
+		},
+		"wrong argument type": {
+			Functions: []interface{}{
+				map[string]interface{}{"name": "a", "params": []interface{}{"x:bool"}, "body": `"${x}"`},
+				map[string]interface{}{"name": "b", "body": `a(list())`},
+			},
+			ExpectErr: `function "b": `,
+		},
+		"not a string": {
+			Functions: []interface{}{
+				map[string]interface{}{"name": "a", "body": `list("a")`},
+			},
+			ExpectErr: `function "a": body must evaluate to a string, got type list`,
+		},
+		"syntax error": {
+			Functions: []interface{}{
+				map[string]interface{}{"name": "a", "body": `upper(`},
+			},
+			ExpectErr: `function "a": `,
+		},
+	}
+
+	for tn, tc := range cases {
+		_, err := readUserFunctions(tc.Functions)
+		if tc.ExpectErr == "" {
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %s", tn, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.ExpectErr) {
+			t.Fatalf("%s: expected error %q, got %v", tn, tc.ExpectErr, err)
+		}
+	}
+}
+
+func TestExecuteUserFunctions(t *testing.T) {
+	user := testUserFunctions(t,
+		map[string]interface{}{"name": "hostname", "params": []interface{}{"role", "index:int"}, "body": `"${role}-${index + 1}.${domain()}"`},
+		map[string]interface{}{"name": "domain", "body": `"example.com"`},
+		map[string]interface{}{"name": "stamp", "params": []interface{}{"s"}, "body": `"${s}@${timestamp()}"`},
+	)
+
+	cases := map[string]struct {
+		Policy    functionPolicy
+		Template  string
+		Expected  string
+		ExpectErr string
+	}{
+		"call": {
+			Template: `${hostname(upper(role), 0)}`,
+			Expected: "WEB-1.example.com",
+		},
+		"string argument converted": {
+			Template: `${hostname(role, "2")}`,
+			Expected: "web-3.example.com",
+		},
+		"allowed": {
+			Policy:   functionPolicy{Allowed: []string{"hostname", "domain"}},
+			Template: `${hostname(role, 0)}`,
+			Expected: "web-1.example.com",
+		},
+		"not in allowed_functions": {
+			Policy:    functionPolicy{Allowed: []string{"upper"}},
+			Template:  `${upper(domain())}`,
+			ExpectErr: `function "domain" at 1:9 is not in allowed_functions`,
+		},
+		"body not in allowed_functions": {
+			Policy:    functionPolicy{Allowed: []string{"hostname"}},
+			Template:  `${hostname(role, 0)}`,
+			ExpectErr: `function "hostname" at 1:3: function "domain" at 1:25 is not in allowed_functions`,
+		},
+		"body nondeterministic": {
+			Policy:    functionPolicy{DenyNondeterministic: true},
+			Template:  `a ${stamp(role)}`,
+			ExpectErr: `function "stamp" at 1:5: function "timestamp" at 1:9 is nondeterministic`,
+		},
+	}
+
+	for tn, tc := range cases {
+		provider := &providerConfig{Functions: tc.Policy, UserFunctions: user}
+		got, err := execute(tc.Template, map[string]interface{}{"role": "web"}, provider)
+		if tc.ExpectErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.ExpectErr) {
+				t.Fatalf("%s: expected error %q, got %v", tn, tc.ExpectErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tn, err)
+		}
+		if got != tc.Expected {
+			t.Fatalf("%s: expected %q, got %q", tn, tc.Expected, got)
+		}
+	}
+}
+
+func TestTemplateUserFunctions(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			r.TestStep{
+				Config: `
+				provider "template" {
+					function {
+						name   = "greet"
+						params = ["name", "times:int"]
+						body   = "format(\"hello %s %d\", upper(name), times)"
+					}
+				}
+				data "template_file" "t0" {
+					template = "$${greet(name, 2)}"
+					vars     = { name = "world" }
+				}
+				output "rendered" {
+					value = "${data.template_file.t0.rendered}"
+				}`,
+				Check: testProviderVarsRendered("hello WORLD 2"),
+			},
+			r.TestStep{
+				Config: `
+				provider "template" {
+					function {
+						name = "loop"
+						body = "loop()"
+					}
+				}
+				data "template_file" "t0" {
+					template = "a"
+				}`,
+				ExpectError: regexp.MustCompile(`function "loop" is recursive: loop -> loop`),
+			},
+		},
+	})
+}
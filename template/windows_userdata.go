@@ -0,0 +1,182 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// windowsContentTypes maps the content type aliases accepted for Windows
+// parts to the kind of script they hold. cloudbase-init runs both kinds from
+// text/x-shellscript parts and tells them apart by their first line.
+var windowsContentTypes = map[string]string{
+	"powershell":        "powershell",
+	"text/x-powershell": "powershell",
+	"batch":             "batch",
+	"cmd":               "batch",
+	"text/x-batch":      "batch",
+}
+
+// powershellHeaders are the first lines cloudbase-init recognizes for
+// PowerShell scripts.
+var powershellHeaders = []string{"#ps1_sysnative", "#ps1_x86", "#ps1"}
+
+const batchHeader = "rem cmd"
+
+// normalizeWindowsPart rewrites a part using one of the Windows content type
+// aliases into the text/x-shellscript part cloudbase-init expects, adding
+// the script header if the content doesn't already have one.
+func normalizeWindowsPart(part cloudInitPart) (cloudInitPart, error) {
+	kind, ok := windowsContentTypes[strings.ToLower(part.ContentType)]
+	if !ok {
+		return part, nil
+	}
+
+	if err := validateWindowsScript(kind, part.Content); err != nil {
+		return part, err
+	}
+
+	part.ContentType = "text/x-shellscript"
+	if windowsScriptType(part.Content) == "" {
+		header := powershellHeaders[0]
+		if kind == "batch" {
+			header = batchHeader
+		}
+		part.Content = header + "\n" + part.Content
+	}
+	return part, nil
+}
+
+func validateWindowsScript(kind, content string) error {
+	firstLine := strings.SplitN(content, "\n", 2)[0]
+	firstLine = strings.TrimSpace(firstLine)
+
+	switch detected := windowsScriptType(content); {
+	case detected != "" && detected != kind:
+		return fmt.Errorf("content of a %s part starts with %q", kind, firstLine)
+	case detected == "" && strings.HasPrefix(firstLine, "#ps1"):
+		return fmt.Errorf("unknown PowerShell header %q, must be one of %s",
+			firstLine, strings.Join(powershellHeaders, ", "))
+	case strings.HasPrefix(firstLine, "#!"):
+		return fmt.Errorf("content of a %s part starts with %q", kind, firstLine)
+	}
+
+	// Only look for wrapper tags around the script, they may legitimately
+	// appear inside it, such as in a string or a heredoc.
+	lines := strings.Split(content, "\n")
+	if windowsScriptType(content) != "" {
+		lines = lines[1:]
+	}
+	first, last := nonBlankLines(lines)
+	for _, tag := range []string{"powershell", "script"} {
+		if strings.HasPrefix(first, "<"+tag+">") || strings.HasSuffix(last, "</"+tag+">") {
+			return fmt.Errorf("content of a %s part must not contain a <%s> wrapper, use output_format = \"windows\" instead", kind, tag)
+		}
+	}
+	return nil
+}
+
+// nonBlankLines returns the first and last non-blank lines, lower cased and
+// trimmed of surrounding white space.
+func nonBlankLines(lines []string) (first, last string) {
+	for _, line := range lines {
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line == "" {
+			continue
+		}
+		if first == "" {
+			first = line
+		}
+		last = line
+	}
+	return first, last
+}
+
+// windowsScriptType returns "powershell" or "batch" if content starts with a
+// header cloudbase-init recognizes, or an empty string otherwise.
+func windowsScriptType(content string) string {
+	firstLine := strings.TrimSpace(strings.SplitN(content, "\n", 2)[0])
+	for _, header := range powershellHeaders {
+		if firstLine == header {
+			return "powershell"
+		}
+	}
+	if strings.ToLower(firstLine) == batchHeader {
+		return "batch"
+	}
+	return ""
+}
+
+// renderWindowsUserData renders PowerShell and batch parts in the
+// <script>/<powershell> wrapper format understood by EC2Config, EC2Launch and
+// cloudbase-init. Parts of each kind are concatenated into a single block, and
+// the batch block comes first as that is the order they run in.
+func renderWindowsUserData(parts cloudInitParts) ([]byte, error) {
+	var batch, powershell []string
+	for i, part := range parts {
+		// The wrapper format has no room for per-part settings.
+		switch {
+		case part.Encoding != "":
+			return nil, fmt.Errorf("part %d: encoding can't be set with output_format \"windows\"", i)
+		case part.Filename != "":
+			return nil, fmt.Errorf("part %d: filename can't be set with output_format \"windows\"", i)
+		case len(part.Headers) > 0:
+			return nil, fmt.Errorf("part %d: headers can't be set with output_format \"windows\"", i)
+		}
+
+		kind := ""
+		if part.ContentType == "text/x-shellscript" {
+			kind = windowsScriptType(part.Content)
+		}
+
+		// Drop the header line, the wrapper tag replaces it. <powershell>
+		// blocks always run in the native PowerShell, so #ps1_x86 scripts
+		// can't be rendered without changing their meaning.
+		lines := strings.SplitN(part.Content, "\n", 2)
+		if strings.TrimSpace(lines[0]) == "#ps1_x86" {
+			return nil, fmt.Errorf("part %d: #ps1_x86 scripts can't be rendered with output_format \"windows\", use output_format \"mime\" instead", i)
+		}
+		body := ""
+		if len(lines) == 2 {
+			body = lines[1]
+		}
+
+		switch kind {
+		case "powershell":
+			powershell = append(powershell, body)
+		case "batch":
+			batch = append(batch, body)
+		default:
+			return nil, fmt.Errorf("part %d: only PowerShell and batch parts can be rendered with output_format \"windows\"", i)
+		}
+	}
+
+	var buffer bytes.Buffer
+	if len(batch) > 0 {
+		fmt.Fprintf(&buffer, "<script>\n%s</script>\n", joinScripts(batch))
+	}
+	if len(powershell) > 0 {
+		fmt.Fprintf(&buffer, "<powershell>\n%s</powershell>\n", joinScripts(powershell))
+	}
+	return buffer.Bytes(), nil
+}
+
+func joinScripts(scripts []string) string {
+	var buffer bytes.Buffer
+	for _, script := range scripts {
+		buffer.WriteString(script)
+		if !strings.HasSuffix(script, "\n") {
+			buffer.WriteString("\n")
+		}
+	}
+	return buffer.String()
+}
+
+func validateOutputFormat(v interface{}, key string) (ws []string, es []error) {
+	switch v.(string) {
+	case "mime", "windows":
+	default:
+		es = append(es, fmt.Errorf("%s: must be one of mime or windows, got %q", key, v.(string)))
+	}
+	return
+}
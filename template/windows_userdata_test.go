@@ -0,0 +1,170 @@
+package template
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	r "github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestNormalizeWindowsPart(t *testing.T) {
+	cases := map[string]struct {
+		Part      cloudInitPart
+		Expected  string
+		ExpectErr string
+	}{
+		"powershell alias adds header": {
+			Part:     cloudInitPart{ContentType: "powershell", Content: "Write-Host hi"},
+			Expected: "#ps1_sysnative\nWrite-Host hi",
+		},
+		"powershell keeps existing header": {
+			Part:     cloudInitPart{ContentType: "text/x-powershell", Content: "#ps1_x86\nWrite-Host hi"},
+			Expected: "#ps1_x86\nWrite-Host hi",
+		},
+		"batch alias adds header": {
+			Part:     cloudInitPart{ContentType: "batch", Content: "echo hi"},
+			Expected: "rem cmd\necho hi",
+		},
+		"unknown powershell header": {
+			Part:      cloudInitPart{ContentType: "powershell", Content: "#ps1_arm\nWrite-Host hi"},
+			ExpectErr: `unknown PowerShell header "#ps1_arm"`,
+		},
+		"mismatched header": {
+			Part:      cloudInitPart{ContentType: "batch", Content: "#ps1\nWrite-Host hi"},
+			ExpectErr: `content of a batch part starts with "#ps1"`,
+		},
+		"wrapper tag": {
+			Part:      cloudInitPart{ContentType: "powershell", Content: "<powershell>Write-Host hi</powershell>"},
+			ExpectErr: `must not contain a <powershell> wrapper`,
+		},
+		"wrapper tag after header": {
+			Part:      cloudInitPart{ContentType: "batch", Content: "rem cmd\n\n<script>\necho hi\n</script>\n"},
+			ExpectErr: `must not contain a <script> wrapper`,
+		},
+		"closing wrapper tag": {
+			Part:      cloudInitPart{ContentType: "powershell", Content: "Write-Host hi\n</powershell>"},
+			ExpectErr: `must not contain a <powershell> wrapper`,
+		},
+		"tag inside script": {
+			Part:     cloudInitPart{ContentType: "powershell", Content: "Write-Host '<script>'\nWrite-Host done"},
+			Expected: "#ps1_sysnative\nWrite-Host '<script>'\nWrite-Host done",
+		},
+	}
+
+	for tn, tc := range cases {
+		part, err := normalizeWindowsPart(tc.Part)
+		if err != nil {
+			if tc.ExpectErr == "" {
+				t.Fatalf("%s: expected no err, got: %s", tn, err)
+			}
+			if !strings.Contains(err.Error(), tc.ExpectErr) {
+				t.Fatalf("%s: expected\n%s\nto contain\n%s", tn, err, tc.ExpectErr)
+			}
+			continue
+		}
+		if tc.ExpectErr != "" {
+			t.Fatalf("%s: expected err containing %q, got none!", tn, tc.ExpectErr)
+		}
+		if part.ContentType != "text/x-shellscript" {
+			t.Fatalf("%s: expected text/x-shellscript, got %s", tn, part.ContentType)
+		}
+		if part.Content != tc.Expected {
+			t.Fatalf("%s: expected %q, got %q", tn, tc.Expected, part.Content)
+		}
+	}
+}
+
+func TestRender_windowsOutputFormat(t *testing.T) {
+	r.UnitTest(t, r.TestCase{
+		Providers: testProviders,
+		Steps: []r.TestStep{
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					gzip          = false
+					base64_encode = false
+					output_format = "windows"
+
+					part {
+						content_type = "powershell"
+						content      = "Write-Host one"
+					}
+					part {
+						content_type = "batch"
+						content      = "echo two"
+					}
+					part {
+						content_type = "text/x-shellscript"
+						content      = "#ps1_sysnative\nWrite-Host three\n"
+					}
+				}`,
+				Check: r.TestCheckResourceAttr("data.template_cloudinit_config.foo", "rendered",
+					"<script>\necho two\n</script>\n<powershell>\nWrite-Host one\nWrite-Host three\n</powershell>\n"),
+			},
+			{
+				Config: `data "template_cloudinit_config" "foo" {
+					output_format = "windows"
+
+					part {
+						content_type = "text/cloud-config"
+						content      = "hostname: foo"
+					}
+				}`,
+				ExpectError: regexp.MustCompile(`part 0: only PowerShell and batch parts can be rendered`),
+			},
+		},
+	})
+}
+
+func TestRender_windowsOutputFormatPartSettings(t *testing.T) {
+	cases := map[string]struct {
+		Part      string
+		ExpectErr string
+	}{
+		"x86 powershell": {
+			`content_type = "powershell"
+			content      = "#ps1_x86\nWrite-Host hi"`,
+			`part 0: #ps1_x86 scripts can't be rendered`,
+		},
+		"encoding": {
+			`content_type = "powershell"
+			content      = "Write-Host hi"
+			encoding     = "base64"`,
+			`part 0: encoding can't be set`,
+		},
+		"filename": {
+			`content_type = "batch"
+			content      = "echo hi"
+			filename     = "hi.cmd"`,
+			`part 0: filename can't be set`,
+		},
+		"headers": {
+			`content_type = "batch"
+			content      = "echo hi"
+			headers {
+				X-Foo = "bar"
+			}`,
+			`part 0: headers can't be set`,
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			r.UnitTest(t, r.TestCase{
+				Providers: testProviders,
+				Steps: []r.TestStep{
+					{
+						Config: `data "template_cloudinit_config" "foo" {
+							output_format = "windows"
+
+							part {
+								` + tc.Part + `
+							}
+						}`,
+						ExpectError: regexp.MustCompile(regexp.QuoteMeta(tc.ExpectErr)),
+					},
+				},
+			})
+		})
+	}
+}